@@ -0,0 +1,42 @@
+// Package brotlienc adds Brotli support to testutil. It's a separate package
+// so that only tests which need Brotli depend on github.com/andybalholm/brotli.
+//
+// Importing it registers a "br" content decoder, so that responses with
+// Content-Encoding: br are decoded transparently by helpers such as
+// UnmarshalBodyToObject. Use CompressBody to send a Brotli compressed request
+// body.
+package brotlienc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/oapi-codegen/testutil"
+)
+
+func init() {
+	testutil.RegisterContentDecoder("br", decode)
+}
+
+// CompressBody compresses the body set on r so far with Brotli, and sets
+// Content-Encoding: br. Call it after setting the body.
+func CompressBody(r *testutil.RequestBuilder) *testutil.RequestBuilder {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	if _, err := w.Write(r.Body); err != nil {
+		r.Error = fmt.Errorf("failed to brotli compress body: %w", err)
+		return r
+	}
+	if err := w.Close(); err != nil {
+		r.Error = fmt.Errorf("failed to brotli compress body: %w", err)
+		return r
+	}
+	r.Body = buf.Bytes()
+	return r.WithHeader("Content-Encoding", "br")
+}
+
+func decode(r io.Reader) (io.Reader, error) {
+	return brotli.NewReader(r), nil
+}
@@ -0,0 +1,47 @@
+package brotlienc
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/oapi-codegen/testutil"
+)
+
+func TestCompressBodyRoundTrip(t *testing.T) {
+	var received string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "br" {
+			t.Errorf("expected Content-Encoding br, got %q", got)
+		}
+		body, err := decode(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = string(raw)
+
+		// Send the body back compressed, to check response decoding.
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "br")
+		compressed := CompressBody(testutil.NewRequest().WithBody(raw)).Body
+		_, _ = w.Write(compressed)
+	})
+
+	c := CompressBody(testutil.NewRequest().Post("/").WithJsonBody(map[string]string{"a": "b"})).
+		GoWithHTTPHandler(t, handler)
+	if received != `{"a":"b"}` {
+		t.Errorf("expected handler to receive the original body, got %q", received)
+	}
+
+	var got map[string]string
+	if err := c.UnmarshalBodyToObject(&got); err != nil {
+		t.Fatalf("failed to decode brotli response: %s", err)
+	}
+	if got["a"] != "b" {
+		t.Errorf("expected decoded response to round trip, got %v", got)
+	}
+}
@@ -0,0 +1,192 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RecordMode controls whether a Cassette records real interactions or
+// replays recorded ones.
+type RecordMode int
+
+const (
+	// RecordModeAuto replays the cassette if its file exists, and records it
+	// otherwise.
+	RecordModeAuto RecordMode = iota
+	// RecordModeRecord always performs real requests, replacing whatever was
+	// recorded before.
+	RecordModeRecord
+	// RecordModeReplay only replays recorded interactions, and fails
+	// requests which weren't recorded.
+	RecordModeReplay
+)
+
+// Cassette is an http.RoundTripper which records the responses to real
+// requests in a JSON file, and replays them on later runs, so tests of
+// handlers which call third-party APIs don't depend on those APIs. Use it as
+// the Transport of the http.Client the handler under test uses. Requests are
+// matched on their method, URL and body, and each recorded interaction is
+// replayed once, in the order they were recorded.
+type Cassette struct {
+	// Path is the file the cassette is stored in.
+	Path string
+	// Transport performs real requests while recording. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	mu           sync.Mutex
+	recording    bool
+	interactions []*cassetteInteraction
+}
+
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+	played   bool
+}
+
+type cassetteRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   []byte `json:"body,omitempty"`
+}
+
+type cassetteResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+}
+
+// NewCassette returns a cassette stored at path. Unless it's recording, the
+// recorded interactions are loaded straight away, so a missing or corrupt
+// file is reported here rather than on the first request.
+func NewCassette(path string, mode RecordMode) (*Cassette, error) {
+	c := &Cassette{Path: path}
+	if mode == RecordModeRecord {
+		c.recording = true
+		return c, nil
+	}
+	raw, err := os.ReadFile(path)
+	if mode == RecordModeAuto && errors.Is(err, fs.ErrNotExist) {
+		c.recording = true
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load cassette: %w", err)
+	}
+	if err := json.Unmarshal(raw, &c.interactions); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Recording reports whether the cassette is recording real interactions,
+// rather than replaying them.
+func (c *Cassette) Recording() bool {
+	return c.recording
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+	key := cassetteRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Body:   body,
+	}
+
+	if c.recording {
+		return c.record(req, key)
+	}
+	return c.replay(req, key)
+}
+
+func (c *Cassette) record(req *http.Request, key cassetteRequest) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(key.Body))
+	req.ContentLength = int64(len(key.Body))
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, &cassetteInteraction{
+		Request: key,
+		Response: cassetteResponse{
+			Status:  resp.StatusCode,
+			Headers: resp.Header,
+			Body:    body,
+		},
+	})
+	c.mu.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, key cassetteRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, i := range c.interactions {
+		if i.played || i.Request.Method != key.Method || i.Request.URL != key.URL || !bytes.Equal(i.Request.Body, key.Body) {
+			continue
+		}
+		i.played = true
+		return &http.Response{
+			Status:        strconv.Itoa(i.Response.Status) + " " + http.StatusText(i.Response.Status),
+			StatusCode:    i.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        i.Response.Headers.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(i.Response.Body)),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction in cassette %s for %s %s", c.Path, key.Method, key.URL)
+}
+
+// Save writes the interactions recorded so far to the cassette's file. It
+// does nothing when the cassette is replaying, so it can always be deferred.
+func (c *Cassette) Save() error {
+	if !c.recording {
+		return nil
+	}
+	c.mu.Lock()
+	buf, err := json.MarshalIndent(c.interactions, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if err := os.WriteFile(c.Path, append(buf, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to save cassette: %w", err)
+	}
+	return nil
+}
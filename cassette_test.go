@@ -0,0 +1,183 @@
+package testutil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// echoServer starts a server which responds with the method, path and body
+// of each request, and counts the requests it served.
+func echoServer(t *testing.T, served *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*served++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Served", "yes")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.Path+" "+string(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doCassette(t *testing.T, c *Cassette, method, url, body string) (*http.Response, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: c}).Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(got), nil
+}
+
+func TestCassetteRecordsAndReplays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	served := 0
+	srv := echoServer(t, &served)
+
+	rec, err := NewCassette(path, RecordModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Recording() {
+		t.Fatal("expected the cassette to be recording")
+	}
+	if _, body, err := doCassette(t, rec, http.MethodPost, srv.URL+"/a", "one"); err != nil || body != "POST /a one" {
+		t.Fatalf("expected the real response while recording, got %q, %v", body, err)
+	}
+	if _, _, err := doCassette(t, rec, http.MethodPost, srv.URL+"/a", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	play, err := NewCassette(path, RecordModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if play.Recording() {
+		t.Fatal("expected the cassette to be replaying")
+	}
+	// Interactions are matched on the body too, whatever order they're
+	// requested in.
+	resp, body, err := doCassette(t, play, http.MethodPost, srv.URL+"/a", "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "POST /a two" {
+		t.Errorf("expected the recorded body, got %q", body)
+	}
+	if resp.StatusCode != http.StatusCreated || resp.Status != "201 Created" {
+		t.Errorf("expected the recorded status, got %d %q", resp.StatusCode, resp.Status)
+	}
+	if resp.Header.Get("X-Served") != "yes" {
+		t.Errorf("expected the recorded headers, got %v", resp.Header)
+	}
+	if _, body, err := doCassette(t, play, http.MethodPost, srv.URL+"/a", "one"); err != nil || body != "POST /a one" {
+		t.Errorf("expected the first recorded response, got %q, %v", body, err)
+	}
+	if served != 2 {
+		t.Errorf("expected 2 real requests, got %d", served)
+	}
+}
+
+func TestCassetteReplaysEachInteractionOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	served := 0
+	srv := echoServer(t, &served)
+
+	rec, err := NewCassette(path, RecordModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := doCassette(t, rec, http.MethodGet, srv.URL+"/a", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	play, err := NewCassette(path, RecordModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := doCassette(t, play, http.MethodGet, srv.URL+"/a", ""); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = doCassette(t, play, http.MethodGet, srv.URL+"/a", "")
+	if err == nil || !strings.Contains(err.Error(), "no recorded interaction in cassette") {
+		t.Errorf("expected the second request to fail, got %v", err)
+	}
+	_, _, err = doCassette(t, play, http.MethodGet, srv.URL+"/b", "")
+	if err == nil || !strings.Contains(err.Error(), "GET "+srv.URL+"/b") {
+		t.Errorf("expected an unrecorded request to fail, got %v", err)
+	}
+	if served != 1 {
+		t.Errorf("expected 1 real request, got %d", served)
+	}
+}
+
+func TestCassetteReplayRequiresFile(t *testing.T) {
+	_, err := NewCassette(filepath.Join(t.TempDir(), "missing.json"), RecordModeReplay)
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to load cassette: ") {
+		t.Errorf("expected a load error, got %v", err)
+	}
+}
+
+func TestCassetteCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewCassette(path, RecordModeAuto)
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to parse cassette ") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestCassetteAutoMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c, err := NewCassette(path, RecordModeAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Recording() {
+		t.Fatal("expected a missing cassette to be recorded")
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewCassette(path, RecordModeAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Recording() {
+		t.Error("expected an existing cassette to be replayed")
+	}
+	// Saving a replaying cassette leaves the file alone.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected Save not to write a replaying cassette, got %v", err)
+	}
+}
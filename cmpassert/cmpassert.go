@@ -0,0 +1,44 @@
+// Package cmpassert provides testutil assertions which compare responses
+// using go-cmp. It's a separate package so that only tests which use it
+// depend on github.com/google/go-cmp.
+package cmpassert
+
+import (
+	"bytes"
+	"net/http/httptest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/oapi-codegen/testutil"
+)
+
+// AssertEqual decodes the response body into a T, like
+// testutil.AssertBodyEquals, and compares it to want using go-cmp, reporting
+// cmp.Diff on mismatch. opts are passed through to go-cmp, for example to
+// ignore fields which vary between runs, such as timestamps. The response
+// body isn't consumed.
+func AssertEqual[T any](t testutil.TestReporter, c *testutil.CompletedRequest, want T, opts ...cmp.Option) {
+	var got T
+	if err := unmarshalCopy(c, &got); err != nil {
+		t.Errorf("failed to unmarshal response: %s", err)
+		return
+	}
+	if diff := cmp.Diff(want, got, opts...); diff != "" {
+		t.Errorf("response body differs from expected %T (-expected +actual):\n%s", want, diff)
+	}
+}
+
+// unmarshalCopy unmarshals a copy of the response with
+// UnmarshalBodyToObject, which would otherwise consume the body.
+func unmarshalCopy(c *testutil.CompletedRequest, obj interface{}) error {
+	rec := httptest.NewRecorder()
+	for h, v := range c.Recorder.Header() {
+		rec.Header()[h] = v
+	}
+	rec.Code = c.Recorder.Code
+	rec.Body = bytes.NewBuffer(append([]byte(nil), c.Recorder.Body.Bytes()...))
+	clone := &testutil.CompletedRequest{
+		Recorder: rec,
+		Strict:   c.Strict,
+	}
+	return clone.UnmarshalBodyToObject(obj)
+}
@@ -0,0 +1,66 @@
+package cmpassert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/oapi-codegen/testutil"
+)
+
+type reporter struct {
+	errors []string
+}
+
+func (r *reporter) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+type event struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+func serveEvent(t *testing.T, e event) *testutil.CompletedRequest {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(e)
+	})
+	return testutil.NewRequest().Get("/event").GoWithHTTPHandler(t, handler)
+}
+
+func TestAssertEqualIgnoresTimestamp(t *testing.T) {
+	c := serveEvent(t, event{Name: "launch", Created: time.Now()})
+
+	r := &reporter{}
+	AssertEqual(r, c, event{Name: "launch"}, cmpopts.IgnoreFields(event{}, "Created"))
+	if len(r.errors) != 0 {
+		t.Errorf("expected no errors, got %q", r.errors)
+	}
+
+	// The body must still be readable afterwards.
+	var e event
+	if err := c.UnmarshalBodyToObject(&e); err != nil || e.Name != "launch" {
+		t.Errorf("expected body to be left intact, got %+v, %v", e, err)
+	}
+}
+
+func TestAssertEqualReportsDiff(t *testing.T) {
+	c := serveEvent(t, event{Name: "launch"})
+
+	r := &reporter{}
+	AssertEqual(r, c, event{Name: "landing"}, cmpopts.IgnoreFields(event{}, "Created"))
+	if len(r.errors) != 1 {
+		t.Fatalf("expected one error, got %q", r.errors)
+	}
+	// go-cmp deliberately varies its output's whitespace, so only look for
+	// the values.
+	if !strings.Contains(r.errors[0], `"landing"`) || !strings.Contains(r.errors[0], `"launch"`) {
+		t.Errorf("expected a cmp diff of the name, got %s", r.errors[0])
+	}
+}
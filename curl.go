@@ -0,0 +1,79 @@
+package testutil
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// BuildCurl renders a curl command equivalent to the request, sent to
+// baseURL, which can be pasted into a shell to reproduce a failing test
+// against a live server. Binary bodies are embedded as base64, and decoded
+// again with base64 -d in a process substitution, which needs bash or zsh.
+func (r *RequestBuilder) BuildCurl(baseURL string) string {
+	url := r.Path
+	if !strings.Contains(url, "://") {
+		url = strings.TrimSuffix(baseURL, "/") + url
+	}
+	if r.RawQuery != "" {
+		url, _, _ = strings.Cut(url, "?")
+		url += "?" + r.RawQuery
+	}
+
+	parts := []string{"curl", "-X", shellQuote(r.Method), shellQuote(url)}
+	if r.Host != "" {
+		parts = append(parts, "-H", shellQuote("Host: "+r.Host))
+	}
+
+	headers := make([]string, 0, len(r.Headers))
+	for h := range r.Headers {
+		headers = append(headers, h)
+	}
+	sort.Strings(headers)
+	for _, h := range headers {
+		parts = append(parts, "-H", shellQuote(h+": "+r.Headers[h]))
+	}
+
+	if len(r.Cookies) > 0 {
+		cookies := make([]string, len(r.Cookies))
+		for i, c := range r.Cookies {
+			cookies[i] = c.Name + "=" + c.Value
+		}
+		parts = append(parts, "--cookie", shellQuote(strings.Join(cookies, "; ")))
+	}
+
+	if r.Body != nil {
+		if isPrintable(r.Body) {
+			parts = append(parts, "--data-binary", shellQuote(string(r.Body)))
+		} else {
+			encoded := base64.StdEncoding.EncodeToString(r.Body)
+			parts = append(parts, "--data-binary", "@<(echo "+encoded+" | base64 -d)")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote quotes s for a POSIX shell, so that it's passed through as a
+// single literal argument.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// isPrintable reports whether a body can be embedded in a command as text,
+// which we take to mean valid UTF-8 without control characters other than
+// whitespace.
+func isPrintable(body []byte) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+	for _, b := range body {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' {
+			return false
+		}
+		if b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
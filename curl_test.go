@@ -0,0 +1,63 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBuildCurl(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *RequestBuilder
+		want string
+	}{
+		{
+			name: "get",
+			r:    NewRequest().Get("/pets"),
+			want: `curl -X 'GET' 'http://localhost:8080/pets'`,
+		},
+		{
+			name: "headers and cookies",
+			r: NewRequest().Post("/pets").WithHost("api.example.com").
+				WithHeader("X-B", "2").WithHeader("X-A", "it's").
+				WithCookie(&http.Cookie{Name: "s", Value: "1"}).WithCookieNameValue("t", "2").
+				WithBody([]byte(`{"name":"rex"}`)),
+			want: `curl -X 'POST' 'http://localhost:8080/pets' -H 'Host: api.example.com' -H 'X-A: it'\''s' -H 'X-B: 2' --cookie 's=1; t=2' --data-binary '{"name":"rex"}'`,
+		},
+		{
+			name: "absolute url",
+			r:    NewRequest().Get("http://other.example.com/a"),
+			want: `curl -X 'GET' 'http://other.example.com/a'`,
+		},
+		{
+			name: "binary body",
+			r:    NewRequest().Put("/blob").WithBody([]byte{0, 1, 2}),
+			want: `curl -X 'PUT' 'http://localhost:8080/blob' --data-binary @<(echo AAEC | base64 -d)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.BuildCurl("http://localhost:8080/"); got != tt.want {
+				t.Errorf("expected\n%s\ngot\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsPrintable(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"plain text\r\n\twith whitespace", true},
+		{"héllo", true},
+		{"bell\a", false},
+		{"del\x7f", false},
+		{"\xff", false},
+	}
+	for _, tt := range tests {
+		if got := isPrintable([]byte(tt.body)); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.body, tt.want, got)
+		}
+	}
+}
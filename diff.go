@@ -0,0 +1,353 @@
+package testutil
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a
+// diff.
+const diffContext = 3
+
+// lineDiff returns a line-oriented diff turning a into b, in the style of a
+// unified diff: removed lines are prefixed with "-", added lines with "+",
+// and unchanged lines with a space. Long runs of unchanged lines are
+// collapsed to "...".
+//
+// The diff is computed with Hirschberg's algorithm, which needs memory
+// linear in the number of lines rather than a table of len(a)*len(b)
+// entries, so large documents can be diffed.
+func lineDiff(a, b []string) string {
+	lines := diffLines(nil, a, b)
+	return strings.Join(collapseUnchanged(removalsFirst(lines)), "\n")
+}
+
+// diffLines appends to lines a minimal diff turning a into b, and returns
+// the result.
+func diffLines(lines, a, b []string) []string {
+	// Lines common to the start and end of both sides don't take part in
+	// the diff, and usually make up most of the documents.
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		lines = append(lines, " "+a[0])
+		a, b = a[1:], b[1:]
+	}
+	var suffix []string
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, " "+a[len(a)-1])
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	switch {
+	case len(a) == 0:
+		lines = prefixLines(lines, "+", b)
+	case len(b) == 0:
+		lines = prefixLines(lines, "-", a)
+	case len(a) == 1:
+		j := 0
+		for j < len(b) && b[j] != a[0] {
+			j++
+		}
+		if j == len(b) {
+			lines = prefixLines(append(lines, "-"+a[0]), "+", b)
+		} else {
+			lines = prefixLines(lines, "+", b[:j])
+			lines = prefixLines(append(lines, " "+a[0]), "+", b[j+1:])
+		}
+	default:
+		// Split a in half, and b where the longest common subsequences of
+		// the halves with the two parts of b add up to the longest overall.
+		mid := len(a) / 2
+		forward := lcsLengths(a[:mid], b)
+		backward := lcsLengths(reversed(a[mid:]), reversed(b))
+		split, best := 0, -1
+		for k := 0; k <= len(b); k++ {
+			if n := forward[k] + backward[len(b)-k]; n > best {
+				split, best = k, n
+			}
+		}
+		lines = diffLines(lines, a[:mid], b[:split])
+		lines = diffLines(lines, a[mid:], b[split:])
+	}
+
+	for i := len(suffix) - 1; i >= 0; i-- {
+		lines = append(lines, suffix[i])
+	}
+	return lines
+}
+
+// lcsLengths returns, for each j, the length of the longest common
+// subsequence of a and b[:j], keeping only two rows of the usual table.
+func lcsLengths(a, b []string) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] >= cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+func reversed(lines []string) []string {
+	r := make([]string, len(lines))
+	for i, l := range lines {
+		r[len(lines)-1-i] = l
+	}
+	return r
+}
+
+func prefixLines(lines []string, prefix string, add []string) []string {
+	for _, l := range add {
+		lines = append(lines, prefix+l)
+	}
+	return lines
+}
+
+// removalsFirst reorders each run of changed lines so that the removed lines
+// come before the added ones, which reads more easily than interleaving them.
+func removalsFirst(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); {
+		if lines[i][0] == ' ' {
+			out = append(out, lines[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(lines) && lines[j][0] != ' ' {
+			j++
+		}
+		for _, l := range lines[i:j] {
+			if l[0] == '-' {
+				out = append(out, l)
+			}
+		}
+		for _, l := range lines[i:j] {
+			if l[0] == '+' {
+				out = append(out, l)
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+// collapseUnchanged replaces unchanged lines which are further than
+// diffContext lines away from any change with a single "..." per run.
+func collapseUnchanged(lines []string) []string {
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if l[0] == ' ' {
+			continue
+		}
+		for k := i - diffContext; k <= i+diffContext; k++ {
+			if k >= 0 && k < len(lines) {
+				keep[k] = true
+			}
+		}
+	}
+
+	var out []string
+	for i, l := range lines {
+		if keep[i] {
+			out = append(out, l)
+		} else if i == 0 || keep[i-1] {
+			out = append(out, "...")
+		}
+	}
+	return out
+}
+
+// valueDiff returns a description of every field, element or map entry at
+// which got differs from want, which must have the same type. path is the Go
+// expression for the location of the values, used in the descriptions.
+//
+// Values whose state is opaque, such as a time.Time, are compared as a whole
+// rather than field by field; see isDiffLeaf.
+func valueDiff(path string, want, got reflect.Value) []string {
+	if !want.IsValid() || !got.IsValid() {
+		if want.IsValid() != got.IsValid() {
+			return []string{mismatch(path, want, got)}
+		}
+		return nil
+	}
+	if isDiffLeaf(want.Type()) {
+		if !leafEqual(want, got) {
+			return []string{mismatch(path, want, got)}
+		}
+		return nil
+	}
+	switch want.Kind() {
+	case reflect.Struct:
+		var diffs []string
+		hidden := false
+		for i := 0; i < want.NumField(); i++ {
+			f := want.Type().Field(i)
+			if !f.IsExported() {
+				hidden = true
+				continue
+			}
+			diffs = append(diffs, valueDiff(path+"."+f.Name, want.Field(i), got.Field(i))...)
+		}
+		// Unexported fields, including embedded structs of unexported
+		// types, can't be read one by one, so a difference in them can
+		// only be reported for the struct as a whole.
+		if hidden && !reflect.DeepEqual(unexportedOnly(want), unexportedOnly(got)) {
+			diffs = append(diffs, mismatch(path, want, got))
+		}
+		return diffs
+	case reflect.Ptr, reflect.Interface:
+		if want.IsNil() || got.IsNil() {
+			break
+		}
+		if want.Kind() == reflect.Interface && want.Elem().Type() != got.Elem().Type() {
+			break
+		}
+		return valueDiff(path, want.Elem(), got.Elem())
+	case reflect.Slice, reflect.Array:
+		if want.Kind() == reflect.Slice && want.IsNil() != got.IsNil() {
+			break
+		}
+		var diffs []string
+		for i := 0; i < want.Len() || i < got.Len(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= got.Len():
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", diffPath(elemPath), formatValue(want.Index(i))))
+			case i >= want.Len():
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", diffPath(elemPath), formatValue(got.Index(i))))
+			default:
+				diffs = append(diffs, valueDiff(elemPath, want.Index(i), got.Index(i))...)
+			}
+		}
+		return diffs
+	case reflect.Map:
+		if want.IsNil() != got.IsNil() {
+			break
+		}
+		keys := make(map[string]reflect.Value)
+		for _, k := range want.MapKeys() {
+			keys[fmt.Sprintf("%#v", k.Interface())] = k
+		}
+		for _, k := range got.MapKeys() {
+			keys[fmt.Sprintf("%#v", k.Interface())] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var diffs []string
+		for _, name := range names {
+			k := keys[name]
+			entryPath := fmt.Sprintf("%s[%s]", path, name)
+			wv, gv := want.MapIndex(k), got.MapIndex(k)
+			switch {
+			case !gv.IsValid():
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", diffPath(entryPath), formatValue(wv)))
+			case !wv.IsValid():
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", diffPath(entryPath), formatValue(gv)))
+			default:
+				diffs = append(diffs, valueDiff(entryPath, wv, gv)...)
+			}
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(want.Interface(), got.Interface()) {
+		return []string{mismatch(path, want, got)}
+	}
+	return nil
+}
+
+// isDiffLeaf reports whether values of type t should be compared as a whole
+// by valueDiff, rather than by descending into them. That's the case for
+// types which define their own equality with an Equal method, types which
+// decode themselves from JSON, and structs without exported fields, all of
+// which keep state that descending into exported fields would miss.
+func isDiffLeaf(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return false
+	case reflect.Struct:
+		exported := false
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				exported = true
+				break
+			}
+		}
+		if !exported {
+			return true
+		}
+	}
+	if _, ok := equalMethod(t); ok {
+		return true
+	}
+	return reflect.PointerTo(t).Implements(jsonUnmarshalerType)
+}
+
+// leafEqual compares two values of a type for which isDiffLeaf is true,
+// using its Equal method if it has one.
+func leafEqual(want, got reflect.Value) bool {
+	if m, ok := equalMethod(want.Type()); ok {
+		return m.Func.Call([]reflect.Value{want, got})[0].Bool()
+	}
+	return reflect.DeepEqual(want.Interface(), got.Interface())
+}
+
+// unexportedOnly returns a copy of the struct v with its exported fields
+// zeroed, so those, which were already compared field by field, don't count
+// again when comparing the rest with reflect.DeepEqual.
+func unexportedOnly(v reflect.Value) interface{} {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	for i := 0; i < c.NumField(); i++ {
+		if c.Type().Field(i).IsExported() {
+			c.Field(i).Set(reflect.Zero(c.Field(i).Type()))
+		}
+	}
+	return c.Interface()
+}
+
+// equalMethod returns t's method of the form Equal(t) bool, as time.Time has.
+func equalMethod(t reflect.Type) (reflect.Method, bool) {
+	m, ok := t.MethodByName("Equal")
+	if !ok {
+		return m, false
+	}
+	mt := m.Type
+	if mt.NumIn() != 2 || mt.In(1) != t || mt.NumOut() != 1 || mt.Out(0).Kind() != reflect.Bool {
+		return m, false
+	}
+	return m, true
+}
+
+// mismatch describes a difference between want and got at path.
+func mismatch(path string, want, got reflect.Value) string {
+	return fmt.Sprintf("%s: expected %s, got %s", diffPath(path), formatValue(want), formatValue(got))
+}
+
+// diffPath names the root of a value for paths which are otherwise empty.
+func diffPath(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return strings.TrimPrefix(path, ".")
+}
+
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%#v", v.Interface())
+}
@@ -0,0 +1,235 @@
+package testutil
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineDiff(t *testing.T) {
+	a := []string{"{", `  "a": 1,`, `  "b": 2`, "}"}
+	b := []string{"{", `  "a": 1,`, `  "b": 3`, "}"}
+
+	want := strings.Join([]string{
+		" {",
+		`   "a": 1,`,
+		`-  "b": 2`,
+		`+  "b": 3`,
+		" }",
+	}, "\n")
+	if got := lineDiff(a, b); got != want {
+		t.Errorf("expected diff:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestLineDiffInsertionsAndDeletions(t *testing.T) {
+	got := lineDiff([]string{"a", "b", "c"}, []string{"b", "c", "d"})
+	want := "-a\n b\n c\n+d"
+	if got != want {
+		t.Errorf("expected diff:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestLineDiffCollapsesUnchangedRuns(t *testing.T) {
+	var a []string
+	for i := 0; i < 20; i++ {
+		a = append(a, string(rune('a'+i)))
+	}
+	b := append([]string(nil), a...)
+	b[10] = "changed"
+
+	lines := strings.Split(lineDiff(a, b), "\n")
+	want := []string{"...", " h", " i", " j", "-k", "+changed", " l", " m", " n", "..."}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected %q, got %q", want, lines)
+	}
+}
+
+// lcsLength is the textbook dynamic programming solution, to check lineDiff
+// against.
+func lcsLength(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else if table[i+1][j] > table[i][j+1] {
+				table[i][j] = table[i+1][j]
+			} else {
+				table[i][j] = table[i][j+1]
+			}
+		}
+	}
+	return table[0][0]
+}
+
+func TestLineDiffIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for n := 0; n < 500; n++ {
+		a, b := randomLines(), randomLines()
+		var gotA, gotB []string
+		unchanged := 0
+		for _, l := range removalsFirst(diffLines(nil, a, b)) {
+			switch l[0] {
+			case ' ':
+				gotA, gotB = append(gotA, l[1:]), append(gotB, l[1:])
+				unchanged++
+			case '-':
+				gotA = append(gotA, l[1:])
+			case '+':
+				gotB = append(gotB, l[1:])
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diff of %q and %q doesn't reproduce them", a, b)
+		}
+		if want := lcsLength(a, b); unchanged != want {
+			t.Fatalf("diff of %q and %q keeps %d lines, expected %d", a, b, unchanged, want)
+		}
+	}
+}
+
+func TestLineDiffLargeDocuments(t *testing.T) {
+	a := make([]string, 20000)
+	for i := range a {
+		a[i] = strconv.Itoa(i)
+	}
+	b := append([]string(nil), a...)
+	b[5000], b[15000] = "x", "y"
+
+	diff := lineDiff(a, b)
+	for _, want := range []string{"-5000\n+x", "-15000\n+y"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected the diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+}
+
+func TestCollapseUnchangedKeepsContextAtEdges(t *testing.T) {
+	lines := []string{"-a", " b", " c", " d", " e", " f", " g", " h", "+i"}
+	want := []string{"-a", " b", " c", " d", "...", " f", " g", " h", "+i"}
+	if got := collapseUnchanged(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+type diffAddress struct {
+	City string
+	Zip  string
+}
+
+type diffUser struct {
+	Name    string
+	Address diffAddress
+	Tags    []string
+	Attrs   map[string]int
+	Created time.Time
+	Raw     json.RawMessage
+	secret  string
+}
+
+func diffValues(want, got interface{}) []string {
+	return valueDiff("", reflect.ValueOf(want), reflect.ValueOf(got))
+}
+
+func TestValueDiffReportsEachField(t *testing.T) {
+	want := diffUser{
+		Name:    "a",
+		Address: diffAddress{City: "x", Zip: "1"},
+		Tags:    []string{"t1", "t2"},
+		Attrs:   map[string]int{"k": 1, "gone": 2},
+	}
+	got := diffUser{
+		Name:    "a",
+		Address: diffAddress{City: "y", Zip: "1"},
+		Tags:    []string{"t1"},
+		Attrs:   map[string]int{"k": 2, "new": 3},
+	}
+
+	diffs := diffValues(want, got)
+	wantDiffs := []string{
+		`Address.City: expected "x", got "y"`,
+		`Tags[1]: missing, expected "t2"`,
+		`Attrs["gone"]: missing, expected 2`,
+		`Attrs["k"]: expected 1, got 2`,
+		`Attrs["new"]: unexpected 3`,
+	}
+	if !reflect.DeepEqual(diffs, wantDiffs) {
+		t.Errorf("expected %q, got %q", wantDiffs, diffs)
+	}
+}
+
+func TestValueDiffEqualValues(t *testing.T) {
+	u := diffUser{Name: "a", Tags: []string{"t"}, Created: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if diffs := diffValues(u, u); len(diffs) != 0 {
+		t.Errorf("expected no differences, got %q", diffs)
+	}
+}
+
+func TestValueDiffComparesTimesWithEqual(t *testing.T) {
+	want := diffUser{Created: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	got := diffUser{Created: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	diffs := diffValues(want, got)
+	if len(diffs) != 1 || !strings.HasPrefix(diffs[0], "Created: ") {
+		t.Errorf("expected the Created field to differ, got %q", diffs)
+	}
+
+	// The same instant in another time zone is equal, as time.Time.Equal
+	// says, even though the fields of the two values differ.
+	same := diffUser{Created: want.Created.In(time.FixedZone("X", 3600))}
+	if diffs := diffValues(want, same); len(diffs) != 0 {
+		t.Errorf("expected equal instants to match, got %q", diffs)
+	}
+}
+
+func TestValueDiffComparesJsonUnmarshalersAsAWhole(t *testing.T) {
+	diffs := diffValues(diffUser{Raw: json.RawMessage(`{"a":1}`)}, diffUser{Raw: json.RawMessage(`{"a":2}`)})
+	if len(diffs) != 1 || !strings.HasPrefix(diffs[0], "Raw: ") {
+		t.Errorf("expected the Raw field to differ as a whole, got %q", diffs)
+	}
+}
+
+func TestValueDiffReportsUnexportedDifferences(t *testing.T) {
+	diffs := diffValues(diffUser{Name: "a", secret: "x"}, diffUser{Name: "a", secret: "y"})
+	if len(diffs) != 1 || !strings.HasPrefix(diffs[0], "value: ") {
+		t.Errorf("expected the struct to differ as a whole, got %q", diffs)
+	}
+
+	diffs = diffValues(diffUser{Name: "a", secret: "x"}, diffUser{Name: "b", secret: "y"})
+	if len(diffs) != 2 || !strings.HasPrefix(diffs[0], "Name: ") || !strings.HasPrefix(diffs[1], "value: ") {
+		t.Errorf("expected exported and unexported differences to both be reported, got %q", diffs)
+	}
+
+	type opaque struct{ n int }
+	diffs = diffValues(opaque{1}, opaque{2})
+	if len(diffs) != 1 {
+		t.Errorf("expected a struct without exported fields to differ, got %q", diffs)
+	}
+}
+
+func TestValueDiffPointersAndNil(t *testing.T) {
+	a, b := &diffAddress{City: "x"}, &diffAddress{City: "y"}
+	if diffs := diffValues(a, b); len(diffs) != 1 || !strings.HasPrefix(diffs[0], "City: ") {
+		t.Errorf("expected pointers to be followed, got %q", diffs)
+	}
+	if diffs := diffValues(a, (*diffAddress)(nil)); len(diffs) != 1 {
+		t.Errorf("expected a nil pointer to differ, got %q", diffs)
+	}
+	if diffs := diffValues([]string(nil), []string{}); len(diffs) != 1 {
+		t.Errorf("expected a nil slice to differ from an empty one, got %q", diffs)
+	}
+}
@@ -0,0 +1,15 @@
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// EchoHeadersHandler responds with the request headers it received, as a JSON
+// object mapping each canonical header name to its list of values. Wrap it in
+// middleware to see exactly which headers the middleware lets through or
+// adds, decoding the response into an http.Header.
+var EchoHeadersHandler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(r.Header)
+})
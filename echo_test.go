@@ -0,0 +1,26 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEchoHeadersHandler(t *testing.T) {
+	addUser := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("X-User", "alice")
+			r.Header.Del("Authorization")
+			next.ServeHTTP(w, r)
+		})
+	}
+	c := NewRequest().Get("/").WithHeader("x-trace", "1").WithAuthorization("Bearer", "t").
+		GoWithHTTPHandler(t, addUser(EchoHeadersHandler))
+
+	var got http.Header
+	if err := c.UnmarshalBodyToObject(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("X-User") != "alice" || got.Get("X-Trace") != "1" || got.Get("Authorization") != "" {
+		t.Errorf("unexpected echoed headers %v", got)
+	}
+}
@@ -0,0 +1,76 @@
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Save writes the response to path as a golden file, in HTTP/1.1 wire format:
+// a status line, the headers, a blank line and then the body. JSON bodies are
+// pretty-printed to keep the files readable and diffable, and Content-Length
+// is updated to match. Use LoadResponse to read the file back.
+func (c *CompletedRequest) Save(path string) error {
+	body := c.Recorder.Body.Bytes()
+	ctype := c.ContentType()
+	if ctype == "application/json" || strings.HasSuffix(ctype, "+json") {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, bytes.TrimSpace(body), "", "  "); err == nil {
+			pretty.WriteByte('\n')
+			body = pretty.Bytes()
+		}
+	}
+
+	header := c.Recorder.Header().Clone()
+	if header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %03d %s\r\n", c.Code(), http.StatusText(c.Code()))
+	if err := header.Write(&buf); err != nil {
+		return fmt.Errorf("failed to write response headers: %w", err)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to save response: %w", err)
+	}
+	return nil
+}
+
+// LoadResponse reads a response written by Save, returning it as a
+// CompletedRequest which can be used with all the usual helpers.
+func LoadResponse(path string) (*CompletedRequest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load response: %w", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body %s: %w", path, err)
+	}
+
+	rec := httptest.NewRecorder()
+	for h, v := range resp.Header {
+		rec.Header()[h] = v
+	}
+	rec.WriteHeader(resp.StatusCode)
+	rec.Body.Write(body)
+	return &CompletedRequest{
+		Recorder: rec,
+	}, nil
+}
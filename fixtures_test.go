@@ -0,0 +1,104 @@
+package testutil
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoadResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "response.http")
+	c := get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Length", "16")
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"a":1,"b":[2]}` + "\n"))
+	}))
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pretty = "{\n  \"a\": 1,\n  \"b\": [\n    2\n  ]\n}\n"
+	if !strings.HasPrefix(string(raw), "HTTP/1.1 201 Created\r\n") {
+		t.Errorf("expected a status line, got %q", raw)
+	}
+	if !strings.HasSuffix(string(raw), "\r\n\r\n"+pretty) {
+		t.Errorf("expected a pretty-printed body, got %q", raw)
+	}
+
+	loaded, err := LoadResponse(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Code() != http.StatusCreated {
+		t.Errorf("expected status 201, got %d", loaded.Code())
+	}
+	if got := loaded.Recorder.Body.String(); got != pretty {
+		t.Errorf("expected body %q, got %q", pretty, got)
+	}
+	if got := loaded.Recorder.Header().Get("Content-Length"); got != strconv.Itoa(len(pretty)) {
+		t.Errorf("expected Content-Length to match the saved body, got %q", got)
+	}
+	if got := loaded.Recorder.Header().Values("X-Multi"); len(got) != 2 {
+		t.Errorf("expected repeated headers to be kept, got %q", got)
+	}
+	var r fakeReporter
+	loaded.AssertJsonContains(&r, `{"b":[2]}`)
+	r.expectNoErrors(t)
+}
+
+func TestSaveKeepsNonJsonBodies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "response.http")
+	for _, tt := range []struct{ ctype, body string }{
+		{"text/plain", `{"a":1}`},
+		{"application/json", "not json"},
+	} {
+		if err := get(t, respond(tt.ctype, tt.body)).Save(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadResponse(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := loaded.Recorder.Body.String(); got != tt.body {
+			t.Errorf("%s: expected body %q, got %q", tt.ctype, tt.body, got)
+		}
+	}
+}
+
+func TestSavePrettyPrintsJsonSuffixTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "response.http")
+	if err := get(t, respond("application/problem+json", `{"title":"x"}`)).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadResponse(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Recorder.Body.String(); got != "{\n  \"title\": \"x\"\n}\n" {
+		t.Errorf("expected a pretty-printed body, got %q", got)
+	}
+}
+
+func TestLoadResponseErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadResponse(filepath.Join(dir, "missing.http")); err == nil || !strings.HasPrefix(err.Error(), "failed to load response: ") {
+		t.Errorf("expected a load error, got %v", err)
+	}
+	path := filepath.Join(dir, "bad.http")
+	if err := os.WriteFile(path, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadResponse(path); err == nil || !strings.HasPrefix(err.Error(), "failed to parse response ") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
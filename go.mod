@@ -1,3 +1,8 @@
 module github.com/oapi-codegen/testutil
 
 go 1.20
+
+require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/google/go-cmp v0.6.0
+)
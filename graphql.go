@@ -0,0 +1,41 @@
+package testutil
+
+import "encoding/json"
+
+// graphQLRequest is the standard envelope for a GraphQL query sent over a
+// POST request.
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// WithGraphQLBody sends a GraphQL query, with optional variables, as a JSON
+// body in the standard {query, variables} envelope.
+func (r *RequestBuilder) WithGraphQLBody(query string, variables map[string]interface{}) *RequestBuilder {
+	return r.WithJsonBody(graphQLRequest{
+		Query:     query,
+		Variables: variables,
+	})
+}
+
+// AssertGraphQLNoErrors checks that the GraphQL response doesn't contain a
+// top-level errors array. GraphQL servers usually respond with a 200 even
+// when the query fails, so checking the status isn't enough.
+func (c *CompletedRequest) AssertGraphQLNoErrors(t TestReporter) {
+	var response struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(c.Recorder.Body.Bytes(), &response); err != nil {
+		t.Errorf("failed to unmarshal graphql response: %s", err)
+		return
+	}
+	if len(response.Errors) > 0 {
+		messages := make([]string, len(response.Errors))
+		for i, e := range response.Errors {
+			messages[i] = e.Message
+		}
+		t.Errorf("expected no graphql errors, got %d: %q", len(messages), messages)
+	}
+}
@@ -0,0 +1,34 @@
+package testutil
+
+import (
+	"testing"
+)
+
+func TestWithGraphQLBody(t *testing.T) {
+	req, body := capture(t, NewRequest().Post("/graphql").WithGraphQLBody("query($id: ID!) { pet(id: $id) { name } }", map[string]interface{}{"id": "1"}))
+	if string(body) != `{"query":"query($id: ID!) { pet(id: $id) { name } }","variables":{"id":"1"}}` {
+		t.Errorf("unexpected body %s", body)
+	}
+	if req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected a JSON body, got %q", req.Header.Get("Content-Type"))
+	}
+
+	_, body = capture(t, NewRequest().Post("/graphql").WithGraphQLBody("{ pets { name } }", nil))
+	if string(body) != `{"query":"{ pets { name } }"}` {
+		t.Errorf("expected variables to be omitted, got %s", body)
+	}
+}
+
+func TestAssertGraphQLNoErrors(t *testing.T) {
+	var r fakeReporter
+	jsonResponse(t, `{"data":{"pet":null}}`).AssertGraphQLNoErrors(&r)
+	jsonResponse(t, `{"data":{},"errors":[]}`).AssertGraphQLNoErrors(&r)
+	r.expectNoErrors(t)
+
+	jsonResponse(t, `{"errors":[{"message":"not found"},{"message":"denied"}]}`).AssertGraphQLNoErrors(&r)
+	r.expectError(t, `expected no graphql errors, got 2: ["not found" "denied"]`)
+
+	r = fakeReporter{}
+	jsonResponse(t, `not json`).AssertGraphQLNoErrors(&r)
+	r.expectError(t, "failed to unmarshal graphql response")
+}
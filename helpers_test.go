@@ -0,0 +1,113 @@
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeReporter is a TestReporter which records failures and log messages,
+// so tests can check what an assertion reported without failing themselves.
+type fakeReporter struct {
+	errors []string
+	logs   []string
+}
+
+func (r *fakeReporter) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *fakeReporter) Logf(format string, args ...interface{}) {
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+// expectNoErrors fails t if the reporter recorded any failures.
+func (r *fakeReporter) expectNoErrors(t *testing.T) {
+	t.Helper()
+	if len(r.errors) > 0 {
+		t.Errorf("expected no errors, got %q", r.errors)
+	}
+}
+
+// expectError fails t unless the reporter recorded exactly one failure,
+// containing want.
+func (r *fakeReporter) expectError(t *testing.T, want string) {
+	t.Helper()
+	if len(r.errors) != 1 {
+		t.Errorf("expected one error containing %q, got %q", want, r.errors)
+	} else if !strings.Contains(r.errors[0], want) {
+		t.Errorf("expected error containing %q, got %q", want, r.errors[0])
+	}
+}
+
+// respond returns a handler which writes body with the given content type.
+func respond(contentType, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+// get performs a GET request against handler.
+func get(t *testing.T, handler http.Handler) *CompletedRequest {
+	t.Helper()
+	c := NewRequest().Get("/").GoWithHTTPHandler(t, handler)
+	if c == nil {
+		t.Fatal("request failed")
+	}
+	return c
+}
+
+// capture performs the request built by r, and returns the request the
+// handler received along with its body.
+func capture(t *testing.T, r *RequestBuilder) (*http.Request, []byte) {
+	t.Helper()
+	var got *http.Request
+	var body []byte
+	c := r.GoWithHTTPHandler(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		body, _ = io.ReadAll(req.Body)
+	}))
+	if c == nil {
+		t.Fatal("request failed")
+	}
+	return got, body
+}
+
+// expectBuildError performs the request built by r, and checks that it
+// failed to be constructed with an error containing want.
+func expectBuildError(t *testing.T, r *RequestBuilder, want string) {
+	t.Helper()
+	var rep fakeReporter
+	called := false
+	c := r.GoWithHTTPHandler(&rep, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}))
+	if c != nil || called {
+		t.Error("expected the request not to be performed")
+	}
+	rep.expectError(t, want)
+}
+
+// jsonResponse performs a request against a handler responding with body as
+// JSON.
+func jsonResponse(t *testing.T, body string) *CompletedRequest {
+	t.Helper()
+	return get(t, respond("application/json", body))
+}
+
+// withHeaders returns a handler which responds with the given headers,
+// status and body.
+func withHeaders(h http.Header, code int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range h {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	})
+}
@@ -0,0 +1,728 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AssertJsonContains checks that the response body is a JSON superset of
+// partial. Every key in partial must be present in the response with a
+// matching value, while extra fields in the response are ignored. Nested
+// objects are matched recursively in the same way.
+//
+// Arrays are matched regardless of order: every element of an array in
+// partial must be contained by at least one element of the corresponding
+// response array. This means a partial of [1] is contained by [2, 1], and
+// the response array may have more elements than the partial one. Use
+// AssertJsonSubsetOrdered when array order matters.
+func (c *CompletedRequest) AssertJsonContains(t TestReporter, partial string) {
+	c.assertJsonSubset(t, partial, false)
+}
+
+// AssertJsonSubsetOrdered is like AssertJsonContains, except that arrays are
+// matched in order: the response array must start with elements containing
+// each of the partial array's elements, in the same order. This means a
+// partial of [1] is contained by [1, 2] but not by [2, 1].
+func (c *CompletedRequest) AssertJsonSubsetOrdered(t TestReporter, partial string) {
+	c.assertJsonSubset(t, partial, true)
+}
+
+func (c *CompletedRequest) assertJsonSubset(t TestReporter, partial string, ordered bool) {
+	var want interface{}
+	if err := json.Unmarshal([]byte(partial), &want); err != nil {
+		t.Errorf("failed to unmarshal partial json: %s", err)
+		return
+	}
+	got, err := c.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	if err := jsonContains("$", want, got, ordered); err != nil {
+		t.Errorf("response json doesn't contain expected value: %s", err)
+	}
+}
+
+// AssertSameJsonAs checks that this response and other have semantically
+// equal JSON bodies, which is useful for checking that a repeated request is
+// idempotent. Object key order doesn't matter, array order does. Every
+// differing path is reported.
+func (c *CompletedRequest) AssertSameJsonAs(t TestReporter, other *CompletedRequest) {
+	got, err := c.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	want, err := other.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal other response json: %s", err)
+		return
+	}
+	if diffs := jsonDiff("$", want, got); len(diffs) > 0 {
+		t.Errorf("response json differs from other response:\n%s", strings.Join(diffs, "\n"))
+	}
+}
+
+// AssertJsonDiff checks that the response body is JSON equal to expected. On
+// mismatch, it reports a line diff of both documents pretty-printed with
+// sorted keys, where "-" lines are expected and "+" lines are actual, which
+// keeps failures on large objects readable.
+func (c *CompletedRequest) AssertJsonDiff(t TestReporter, expected string) {
+	var want interface{}
+	if err := json.Unmarshal([]byte(expected), &want); err != nil {
+		t.Errorf("failed to unmarshal expected json: %s", err)
+		return
+	}
+	got, err := c.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	if reflect.DeepEqual(want, got) {
+		return
+	}
+	wantJson, _ := json.MarshalIndent(want, "", "  ")
+	gotJson, _ := json.MarshalIndent(got, "", "  ")
+	diff := lineDiff(strings.Split(string(wantJson), "\n"), strings.Split(string(gotJson), "\n"))
+	t.Errorf("response json differs from expected (-expected +actual):\n%s", diff)
+}
+
+// AssertBodyEquals decodes the response body into a T, based on its
+// Content-Type like UnmarshalBodyToObject, and checks that it's deeply equal
+// to want. On mismatch, every differing field is reported. Unlike
+// UnmarshalBodyToObject, this doesn't consume the body.
+func AssertBodyEquals[T any](t TestReporter, c *CompletedRequest, want T) {
+	var got T
+	if err := c.unmarshalBody(bytes.NewReader(c.Recorder.Body.Bytes()), &got); err != nil {
+		t.Errorf("failed to unmarshal response: %s", err)
+		return
+	}
+	if diffs := valueDiff("", reflect.ValueOf(want), reflect.ValueOf(got)); len(diffs) > 0 {
+		t.Errorf("response body differs from expected %T:\n%s", want, strings.Join(diffs, "\n"))
+	}
+}
+
+// AssertExactStruct checks that the response's JSON body unmarshals into a T,
+// and that it has no fields which T doesn't declare, at any depth. Unlike
+// Strict, which fails on the first unknown field, every extra field is
+// reported by its dotted path, which is useful for catching undocumented
+// fields.
+func AssertExactStruct[T any](t TestReporter, c *CompletedRequest) {
+	var doc interface{}
+	if err := json.Unmarshal(c.Recorder.Body.Bytes(), &doc); err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	var typed T
+	if extra := unknownJsonFields("", doc, reflect.TypeOf(&typed).Elem()); len(extra) > 0 {
+		t.Errorf("response json has fields not declared by %T: %q", typed, extra)
+		return
+	}
+	d := json.NewDecoder(bytes.NewReader(c.Recorder.Body.Bytes()))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&typed); err != nil {
+		t.Errorf("failed to unmarshal response into %T: %s", typed, err)
+	}
+}
+
+// AssertJsonFieldType checks the JSON type of the field at the given dotted
+// path, without caring about its value. wantType is one of "string",
+// "number", "bool", "object", "array" or "null".
+func (c *CompletedRequest) AssertJsonFieldType(t TestReporter, field, wantType string) {
+	v, err := c.lookupJsonField(field)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	if got := jsonTypeName(v); got != wantType {
+		t.Errorf("expected field %q to be of type %s, got %s", field, wantType, got)
+	}
+}
+
+// AssertJsonFieldNull checks that the field at the given dotted path is
+// present in the response and explicitly null, as opposed to absent.
+func (c *CompletedRequest) AssertJsonFieldNull(t TestReporter, field string) {
+	doc, err := c.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	v, ok := jsonField(doc, field)
+	if !ok {
+		t.Errorf("expected field %q to be null, but it's absent", field)
+	} else if v != nil {
+		t.Errorf("expected field %q to be null, but it's present with value %s", field, marshalForMessage(v))
+	}
+}
+
+// AssertJsonFieldAbsent checks that there's no field at the given dotted path
+// in the response. A field which is present with a null value doesn't count
+// as absent.
+func (c *CompletedRequest) AssertJsonFieldAbsent(t TestReporter, field string) {
+	doc, err := c.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	if v, ok := jsonField(doc, field); ok {
+		if v == nil {
+			t.Errorf("expected field %q to be absent, but it's present and null", field)
+		} else {
+			t.Errorf("expected field %q to be absent, but it's present with value %s", field, marshalForMessage(v))
+		}
+	}
+}
+
+// AssertJsonKeysPresent checks that there's a field at each of the given
+// dotted paths in the response, whatever its value, including null. All the
+// missing keys are reported together.
+func (c *CompletedRequest) AssertJsonKeysPresent(t TestReporter, keys ...string) {
+	doc, err := c.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	var missing []string
+	for _, k := range keys {
+		if _, ok := jsonField(doc, k); !ok {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("expected keys %q in response json, but they are missing", missing)
+	}
+}
+
+// AssertJsonFieldGreaterThan checks that the field at the given dotted path is
+// a number greater than n.
+func (c *CompletedRequest) AssertJsonFieldGreaterThan(t TestReporter, field string, n float64) {
+	if v, ok := c.jsonNumberField(t, field); ok && !(v > n) {
+		t.Errorf("expected field %q to be greater than %v, got %v", field, n, v)
+	}
+}
+
+// AssertJsonFieldLessThan checks that the field at the given dotted path is a
+// number less than n.
+func (c *CompletedRequest) AssertJsonFieldLessThan(t TestReporter, field string, n float64) {
+	if v, ok := c.jsonNumberField(t, field); ok && !(v < n) {
+		t.Errorf("expected field %q to be less than %v, got %v", field, n, v)
+	}
+}
+
+// AssertJsonFieldInt checks that the field at the given dotted path is an
+// integer equal to want. The number is checked as written in the response, so
+// unlike comparing float64 values, 7.0 or 7.5 won't pass as 7.
+func (c *CompletedRequest) AssertJsonFieldInt(t TestReporter, field string, want int64) {
+	doc, err := c.decodeJsonNumbers()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	v, ok := jsonField(doc, field)
+	if !ok {
+		t.Errorf("field %q not found in response json", field)
+		return
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		t.Errorf("expected field %q to be a number, got %s", field, jsonTypeName(v))
+		return
+	}
+	got, err := n.Int64()
+	if err != nil {
+		t.Errorf("expected field %q to be an integer, got %s", field, n)
+		return
+	}
+	if got != want {
+		t.Errorf("expected field %q to be %d, got %d", field, want, got)
+	}
+}
+
+// AssertJsonFieldEqualsStatus checks that the field at the given dotted path,
+// such as an error code in the body, matches the response's status code,
+// catching handlers whose body and status disagree. The field may be a number
+// or a numeric string.
+func (c *CompletedRequest) AssertJsonFieldEqualsStatus(t TestReporter, field string) {
+	doc, err := c.decodeJsonNumbers()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	v, ok := jsonField(doc, field)
+	if !ok {
+		t.Errorf("field %q not found in response json", field)
+		return
+	}
+	var raw string
+	switch value := v.(type) {
+	case json.Number:
+		raw = value.String()
+	case string:
+		raw = value
+	default:
+		t.Errorf("expected field %q to be a number or numeric string, got %s", field, jsonTypeName(v))
+		return
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		t.Errorf("expected field %q to be a status code, got %q", field, raw)
+		return
+	}
+	if code != c.Code() {
+		t.Errorf("expected field %q to match status %d %s, got %d", field, c.Code(), http.StatusText(c.Code()), code)
+	}
+}
+
+// AssertJsonFieldOneOf checks that the field at the given dotted path is
+// equal to one of the allowed values, which is handy for enums. The allowed
+// values are compared in their JSON form, so an int matches the equivalent
+// JSON number.
+func (c *CompletedRequest) AssertJsonFieldOneOf(t TestReporter, field string, allowed ...interface{}) {
+	v, err := c.lookupJsonField(field)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	for _, a := range allowed {
+		want, err := normalizeJson(a)
+		if err != nil {
+			t.Errorf("failed to marshal allowed value %v: %s", a, err)
+			return
+		}
+		if reflect.DeepEqual(want, v) {
+			return
+		}
+	}
+	t.Errorf("expected field %q to be one of %s, got %s", field, marshalForMessage(allowed), marshalForMessage(v))
+}
+
+// AssertJsonArrayContains checks that the field at the given dotted path is
+// an array with at least one element equal to want, regardless of order. want
+// is compared in its JSON form, so it may be a struct or map to match a whole
+// object element.
+func (c *CompletedRequest) AssertJsonArrayContains(t TestReporter, field string, want interface{}) {
+	v, err := c.lookupJsonField(field)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	array, ok := v.([]interface{})
+	if !ok {
+		t.Errorf("expected field %q to be an array, got %s", field, jsonTypeName(v))
+		return
+	}
+	normalized, err := normalizeJson(want)
+	if err != nil {
+		t.Errorf("failed to marshal expected value %v: %s", want, err)
+		return
+	}
+	for _, e := range array {
+		if reflect.DeepEqual(normalized, e) {
+			return
+		}
+	}
+	t.Errorf("expected field %q to contain %s, got %s", field, marshalForMessage(normalized), marshalForMessage(array))
+}
+
+// AssertJsonFieldMatches checks that the field at the given dotted path is a
+// string matching the regular expression pattern, which is useful for values
+// such as IDs and timestamps.
+func (c *CompletedRequest) AssertJsonFieldMatches(t TestReporter, field, pattern string) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		t.Errorf("invalid pattern %q: %s", pattern, err)
+		return
+	}
+	v, err := c.lookupJsonField(field)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	s, ok := v.(string)
+	if !ok {
+		t.Errorf("expected field %q to be a string, got %s", field, jsonTypeName(v))
+		return
+	}
+	if !re.MatchString(s) {
+		t.Errorf("expected field %q to match %q, got %q", field, pattern, s)
+	}
+}
+
+// JsonField returns the value at the given dotted path in the response's JSON
+// body, converted to T. The value is converted as encoding/json would
+// unmarshal it, so numbers can be read into any numeric type that holds them
+// exactly, and objects into structs.
+func JsonField[T any](c *CompletedRequest, path string) (T, error) {
+	var result T
+	doc, err := c.decodeJsonNumbers()
+	if err != nil {
+		return result, fmt.Errorf("failed to unmarshal response json: %w", err)
+	}
+	v, ok := jsonField(doc, path)
+	if !ok {
+		return result, fmt.Errorf("field %q not found in response json", path)
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return result, fmt.Errorf("failed to marshal field %q: %w", path, err)
+	}
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return result, fmt.Errorf("can't convert field %q to %T: %w", path, result, err)
+	}
+	return result, nil
+}
+
+// jsonNumberField returns the number at the given dotted path, reporting an
+// error and returning false if it's missing or not a number.
+func (c *CompletedRequest) jsonNumberField(t TestReporter, field string) (float64, bool) {
+	v, err := c.lookupJsonField(field)
+	if err != nil {
+		t.Errorf("%s", err)
+		return 0, false
+	}
+	n, ok := v.(float64)
+	if !ok {
+		t.Errorf("expected field %q to be a number, got %s", field, jsonTypeName(v))
+	}
+	return n, ok
+}
+
+// lookupJsonField decodes the response body and returns the value at the given
+// dotted path, failing if it doesn't exist.
+func (c *CompletedRequest) lookupJsonField(path string) (interface{}, error) {
+	doc, err := c.decodeJson()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response json: %w", err)
+	}
+	v, ok := jsonField(doc, path)
+	if !ok {
+		return nil, fmt.Errorf("field %q not found in response json", path)
+	}
+	return v, nil
+}
+
+// jsonField navigates a dotted path such as "items.0.name" through a decoded
+// JSON document, where numeric segments index into arrays. The bool result is
+// false when there's nothing at the path. An empty path refers to the whole
+// document.
+func jsonField(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
+	}
+	v := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// decodeJson decodes the response body into generic JSON values, without
+// consuming it.
+func (c *CompletedRequest) decodeJson() (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(c.Recorder.Body.Bytes(), &v)
+	return v, err
+}
+
+// decodeJsonNumbers is like decodeJson, but decodes numbers as json.Number,
+// preserving them as they were written.
+func (c *CompletedRequest) decodeJsonNumbers() (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(c.Recorder.Body.Bytes()))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
+	return v, err
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownJsonFields returns the dotted paths of the object keys in v, a
+// decoded JSON value at path, which encoding/json would ignore when
+// unmarshaling into typ. Types with their own UnmarshalJSON are trusted to
+// handle whatever they're given.
+func unknownJsonFields(path string, v interface{}, typ reflect.Type) []string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if reflect.PointerTo(typ).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	var unknown []string
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := jsonStructFields(typ)
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ft, ok := fields[k]
+			if !ok {
+				// encoding/json falls back to a case-insensitive match.
+				for name, t := range fields {
+					if strings.EqualFold(name, k) {
+						ft, ok = t, true
+						break
+					}
+				}
+			}
+			if !ok {
+				unknown = append(unknown, join(k))
+				continue
+			}
+			unknown = append(unknown, unknownJsonFields(join(k), obj[k], ft)...)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			unknown = append(unknown, unknownJsonFields(join(k), obj[k], typ.Elem())...)
+		}
+	case reflect.Slice, reflect.Array:
+		array, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, e := range array {
+			unknown = append(unknown, unknownJsonFields(join(strconv.Itoa(i)), e, typ.Elem())...)
+		}
+	}
+	return unknown
+}
+
+// jsonStructFields returns the JSON names of the fields encoding/json would
+// unmarshal into the struct type typ, including those promoted from embedded
+// structs, along with their types.
+func jsonStructFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, t := range jsonStructFields(ft) {
+					if _, ok := fields[n]; !ok {
+						fields[n] = t
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// jsonContains returns an error describing the first place where got doesn't
+// contain want. path is the location of want within the document, and is
+// used in error messages. When ordered is set, arrays in want must match a
+// prefix of the arrays in got, rather than any of their elements.
+func jsonContains(path string, want, got interface{}, ordered bool) error {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %s", path, jsonTypeName(got))
+		}
+		for k, wv := range w {
+			gv, ok := g[k]
+			if !ok {
+				return fmt.Errorf("%s.%s: missing", path, k)
+			}
+			if err := jsonContains(path+"."+k, wv, gv, ordered); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %s", path, jsonTypeName(got))
+		}
+		if ordered {
+			if len(g) < len(w) {
+				return fmt.Errorf("%s: expected at least %d elements, got %d", path, len(w), len(g))
+			}
+			for i, wv := range w {
+				if err := jsonContains(fmt.Sprintf("%s[%d]", path, i), wv, g[i], ordered); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for i, wv := range w {
+			found := false
+			for _, gv := range g {
+				if jsonContains(path, wv, gv, ordered) == nil {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s: no element contains partial element %d (%s)", path, i, marshalForMessage(wv))
+			}
+		}
+		return nil
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Errorf("%s: expected %s, got %s", path, marshalForMessage(want), marshalForMessage(got))
+		}
+		return nil
+	}
+}
+
+// jsonDiff returns a description of every path at which got differs from
+// want.
+func jsonDiff(path string, want, got interface{}) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, k := range keys {
+			wv, inWant := w[k]
+			gv, inGot := g[k]
+			switch {
+			case !inGot:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing, expected %s", path, k, marshalForMessage(wv)))
+			case !inWant:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: unexpected %s", path, k, marshalForMessage(gv)))
+			default:
+				diffs = append(diffs, jsonDiff(path+"."+k, wv, gv)...)
+			}
+		}
+		return diffs
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			break
+		}
+		var diffs []string
+		for i := 0; i < len(w) || i < len(g); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(g):
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", elemPath, marshalForMessage(w[i])))
+			case i >= len(w):
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", elemPath, marshalForMessage(g[i])))
+			default:
+				diffs = append(diffs, jsonDiff(elemPath, w[i], g[i])...)
+			}
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(want, got) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, marshalForMessage(want), marshalForMessage(got))}
+	}
+	return nil
+}
+
+// normalizeJson converts a Go value into the generic form produced by
+// decoding JSON, by round-tripping it through encoding/json, so that it can be
+// compared to decoded values. For example, an int becomes a float64.
+func normalizeJson(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	err = json.Unmarshal(buf, &normalized)
+	return normalized, err
+}
+
+// jsonTypeName returns the JSON type of a value produced by decoding into an
+// interface{}.
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// marshalForMessage renders a decoded JSON value for use in an error message.
+func marshalForMessage(v interface{}) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(buf)
+}
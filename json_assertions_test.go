@@ -0,0 +1,356 @@
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testBase struct {
+	ID string `json:"id"`
+}
+
+type testItem struct {
+	Name string `json:"name"`
+}
+
+type testDoc struct {
+	testBase
+	Title   string              `json:"title"`
+	Items   []testItem          `json:"items"`
+	ByName  map[string]testItem `json:"by_name"`
+	Raw     json.RawMessage     `json:"raw"`
+	Ignored string              `json:"-"`
+	Plain   string
+	hidden  string
+}
+
+func TestUnknownJsonFields(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"all declared", `{"id":"1","title":"t","items":[{"name":"a"}],"by_name":{"a":{"name":"a"}},"Plain":"p"}`, nil},
+		{"case insensitive", `{"ID":"1","TITLE":"t","plain":"p"}`, nil},
+		{"top level", `{"id":"1","extra":1,"another":2}`, []string{"another", "extra"}},
+		{"in array elements", `{"items":[{"name":"a"},{"name":"b","size":2}]}`, []string{"items.1.size"}},
+		{"in map values", `{"by_name":{"a":{"name":"a","size":1}}}`, []string{"by_name.a.size"}},
+		{"raw message", `{"raw":{"anything":true}}`, nil},
+		{"ignored field", `{"Ignored":"x"}`, []string{"Ignored"}},
+		{"unexported field", `{"hidden":"x"}`, []string{"hidden"}},
+		{"type mismatch", `{"items":{"name":"a"}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			if err := json.Unmarshal([]byte(tt.body), &doc); err != nil {
+				t.Fatal(err)
+			}
+			got := unknownJsonFields("", doc, reflect.TypeOf(&testDoc{}))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAssertExactStruct(t *testing.T) {
+	var r fakeReporter
+	AssertExactStruct[testDoc](&r, jsonResponse(t, `{"id":"1","items":[{"name":"a"}]}`))
+	r.expectNoErrors(t)
+
+	r = fakeReporter{}
+	AssertExactStruct[testDoc](&r, jsonResponse(t, `{"id":"1","items":[{"name":"a","x":1}],"y":2}`))
+	r.expectError(t, `["items.0.x" "y"]`)
+
+	r = fakeReporter{}
+	AssertExactStruct[testDoc](&r, jsonResponse(t, `{"id":1}`))
+	r.expectError(t, "failed to unmarshal response into testutil.testDoc")
+}
+
+func TestAssertJsonContains(t *testing.T) {
+	const body = `{"a":1,"b":{"c":"x","d":[1,2,3]},"e":[{"id":1,"n":"one"},{"id":2,"n":"two"}]}`
+	tests := []struct {
+		partial string
+		err     string
+	}{
+		{partial: `{"a":1}`},
+		{partial: `{"b":{"c":"x"}}`},
+		{partial: `{"b":{"d":[3,1]}}`},
+		{partial: `{"e":[{"id":2}]}`},
+		{partial: `{"b":{"d":[4]}}`, err: "$.b.d: no element contains partial element 0 (4)"},
+		{partial: `{"z":1}`, err: "$.z: missing"},
+		{partial: `{"a":"1"}`, err: `$.a: expected "1", got 1`},
+		{partial: `{"a":{}}`, err: "$.a: expected an object, got number"},
+		{partial: `{"b":[]}`, err: "$.b: expected an array, got object"},
+		{partial: `{`, err: "failed to unmarshal partial json"},
+	}
+	c := jsonResponse(t, body)
+	for _, tt := range tests {
+		t.Run(tt.partial, func(t *testing.T) {
+			var r fakeReporter
+			c.AssertJsonContains(&r, tt.partial)
+			if tt.err == "" {
+				r.expectNoErrors(t)
+			} else {
+				r.expectError(t, tt.err)
+			}
+		})
+	}
+}
+
+func TestAssertJsonSubsetOrdered(t *testing.T) {
+	tests := []struct {
+		partial string
+		err     string
+	}{
+		{partial: `{"b":{"d":[1,2]}}`},
+		{partial: `{"b":{"d":[2]}}`, err: "$.b.d[0]: expected 2, got 1"},
+		{partial: `{"b":{"d":[1,2,3,4]}}`, err: "$.b.d: expected at least 4 elements, got 3"},
+	}
+	c := jsonResponse(t, `{"b":{"d":[1,2,3]}}`)
+	for _, tt := range tests {
+		t.Run(tt.partial, func(t *testing.T) {
+			var r fakeReporter
+			c.AssertJsonSubsetOrdered(&r, tt.partial)
+			if tt.err == "" {
+				r.expectNoErrors(t)
+			} else {
+				r.expectError(t, tt.err)
+			}
+		})
+	}
+}
+
+func TestAssertJsonDiff(t *testing.T) {
+	c := jsonResponse(t, `{"b":2,"a":1}`)
+	var r fakeReporter
+	c.AssertJsonDiff(&r, `{"a":1,"b":2}`)
+	r.expectNoErrors(t)
+
+	c.AssertJsonDiff(&r, `{"a":1,"b":3}`)
+	r.expectError(t, "(-expected +actual):\n {\n   \"a\": 1,\n-  \"b\": 3\n+  \"b\": 2\n }")
+}
+
+func TestAssertSameJsonAs(t *testing.T) {
+	var r fakeReporter
+	jsonResponse(t, `{"a":1,"b":[1,2]}`).AssertSameJsonAs(&r, jsonResponse(t, `{"b":[1,2],"a":1}`))
+	r.expectNoErrors(t)
+
+	jsonResponse(t, `{"a":1,"b":[1],"c":true}`).AssertSameJsonAs(&r, jsonResponse(t, `{"a":2,"b":[1,2]}`))
+	r.expectError(t, "$.a: expected 2, got 1\n$.b[1]: missing, expected 2\n$.c: unexpected true")
+}
+
+func TestAssertJsonFieldInt(t *testing.T) {
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{body: `{"n":7}`},
+		{body: `{"n":7.0}`, err: `expected field "n" to be an integer, got 7.0`},
+		{body: `{"n":7.5}`, err: `expected field "n" to be an integer, got 7.5`},
+		{body: `{"n":8}`, err: `expected field "n" to be 7, got 8`},
+		{body: `{"n":"7"}`, err: `expected field "n" to be a number, got string`},
+		{body: `{}`, err: `field "n" not found in response json`},
+		{body: `{"n":9007199254740993}`, err: "got 9007199254740993"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var r fakeReporter
+			jsonResponse(t, tt.body).AssertJsonFieldInt(&r, "n", 7)
+			if tt.err == "" {
+				r.expectNoErrors(t)
+			} else {
+				r.expectError(t, tt.err)
+			}
+		})
+	}
+}
+
+func TestJsonField(t *testing.T) {
+	c := jsonResponse(t, `{"items":[{"name":"a","size":9007199254740993}],"ok":true}`)
+
+	name, err := JsonField[string](c, "items.0.name")
+	if err != nil || name != "a" {
+		t.Errorf("expected %q, got %q, %v", "a", name, err)
+	}
+	size, err := JsonField[int64](c, "items.0.size")
+	if err != nil || size != 9007199254740993 {
+		t.Errorf("expected the exact number, got %d, %v", size, err)
+	}
+	item, err := JsonField[testItem](c, "items.0")
+	if err != nil || item.Name != "a" {
+		t.Errorf("expected the item, got %+v, %v", item, err)
+	}
+	if _, err := JsonField[string](c, "items.1.name"); err == nil || err.Error() != `field "items.1.name" not found in response json` {
+		t.Errorf("expected a missing field error, got %v", err)
+	}
+	if _, err := JsonField[string](c, "ok"); err == nil || !strings.HasPrefix(err.Error(), `can't convert field "ok" to string`) {
+		t.Errorf("expected a conversion error, got %v", err)
+	}
+}
+
+func TestJsonFieldPaths(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"a":{"b":[10,{"c":null}]}}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"a.b.0", 10.0, true},
+		{"a.b.1.c", nil, true},
+		{"a.b.2", nil, false},
+		{"a.b.-1", nil, false},
+		{"a.b.x", nil, false},
+		{"a.z", nil, false},
+		{"a.b.0.c", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := jsonField(doc, tt.path)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, %v, got %v, %v", tt.path, tt.want, tt.ok, got, ok)
+		}
+	}
+	if got, ok := jsonField(doc, ""); !ok || !reflect.DeepEqual(got, doc) {
+		t.Errorf("expected an empty path to return the document, got %v", got)
+	}
+}
+
+func TestAssertJsonKeysPresent(t *testing.T) {
+	c := jsonResponse(t, `{"a":null,"b":1}`)
+	var r fakeReporter
+	c.AssertJsonKeysPresent(&r, "a", "b")
+	r.expectNoErrors(t)
+
+	c.AssertJsonKeysPresent(&r, "a", "c", "d")
+	r.expectError(t, `expected keys ["c" "d"] in response json`)
+}
+
+func TestAssertJsonFieldNullAndAbsent(t *testing.T) {
+	c := jsonResponse(t, `{"a":null,"b":1}`)
+	var r fakeReporter
+	c.AssertJsonFieldNull(&r, "a")
+	c.AssertJsonFieldAbsent(&r, "c")
+	r.expectNoErrors(t)
+
+	c.AssertJsonFieldNull(&r, "b")
+	r.expectError(t, `expected field "b" to be null, but it's present with value 1`)
+
+	r = fakeReporter{}
+	c.AssertJsonFieldAbsent(&r, "a")
+	r.expectError(t, `expected field "a" to be absent, but it's present and null`)
+}
+
+func TestAssertJsonArrayContains(t *testing.T) {
+	c := jsonResponse(t, `{"tags":["x","y"],"items":[{"id":1,"name":"a"}],"n":1}`)
+	var r fakeReporter
+	c.AssertJsonArrayContains(&r, "tags", "y")
+	c.AssertJsonArrayContains(&r, "items", map[string]interface{}{"id": 1, "name": "a"})
+	r.expectNoErrors(t)
+
+	c.AssertJsonArrayContains(&r, "tags", "z")
+	r.expectError(t, `expected field "tags" to contain "z", got ["x","y"]`)
+
+	r = fakeReporter{}
+	c.AssertJsonArrayContains(&r, "n", 1)
+	r.expectError(t, `expected field "n" to be an array, got number`)
+}
+
+func TestAssertJsonFieldEqualsStatus(t *testing.T) {
+	status := func(code int, body string) *CompletedRequest {
+		return get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{body: `{"code":404}`},
+		{body: `{"code":" 404"}`},
+		{body: `{"code":500}`, err: `expected field "code" to match status 404 Not Found, got 500`},
+		{body: `{"code":"nope"}`, err: `expected field "code" to be a status code, got "nope"`},
+		{body: `{"code":true}`, err: `expected field "code" to be a number or numeric string, got bool`},
+		{body: `{}`, err: `field "code" not found in response json`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			var r fakeReporter
+			status(http.StatusNotFound, tt.body).AssertJsonFieldEqualsStatus(&r, "code")
+			if tt.err == "" {
+				r.expectNoErrors(t)
+			} else {
+				r.expectError(t, tt.err)
+			}
+		})
+	}
+}
+
+func TestAssertBodyEquals(t *testing.T) {
+	c := jsonResponse(t, `{"id":"1","title":"t","items":[{"name":"a"}]}`)
+	var r fakeReporter
+	AssertBodyEquals(&r, c, testDoc{testBase: testBase{ID: "1"}, Title: "t", Items: []testItem{{Name: "a"}}})
+	r.expectNoErrors(t)
+
+	AssertBodyEquals(&r, c, testDoc{testBase: testBase{ID: "1"}, Title: "u", Items: []testItem{{Name: "a"}}})
+	r.expectError(t, `Title: expected "u", got "t"`)
+
+	// The embedded struct's type is unexported, so it's compared as a
+	// whole, alongside the other fields.
+	r = fakeReporter{}
+	AssertBodyEquals(&r, c, testDoc{testBase: testBase{ID: "2"}, Title: "u", Items: []testItem{{Name: "a"}}})
+	r.expectError(t, "Title: expected \"u\", got \"t\"\nvalue: expected")
+
+	if c.Recorder.Body.Len() == 0 {
+		t.Error("expected AssertBodyEquals not to consume the body")
+	}
+}
+
+func TestAssertJsonFieldType(t *testing.T) {
+	c := jsonResponse(t, `{"s":"abc","n":5,"b":true,"o":{},"a":[],"z":null}`)
+	var r fakeReporter
+	for field, typ := range map[string]string{"s": "string", "n": "number", "b": "bool", "o": "object", "a": "array", "z": "null"} {
+		c.AssertJsonFieldType(&r, field, typ)
+	}
+	r.expectNoErrors(t)
+}
+
+func TestAssertJsonFieldGreaterAndLessThan(t *testing.T) {
+	c := jsonResponse(t, `{"n":5}`)
+	var r fakeReporter
+	c.AssertJsonFieldGreaterThan(&r, "n", 4)
+	c.AssertJsonFieldLessThan(&r, "n", 6)
+	r.expectNoErrors(t)
+
+	c.AssertJsonFieldGreaterThan(&r, "n", 5)
+	r.expectError(t, `expected field "n" to be greater than 5, got 5`)
+}
+
+func TestAssertJsonFieldMatches(t *testing.T) {
+	c := jsonResponse(t, `{"s":"abc-123"}`)
+	var r fakeReporter
+	c.AssertJsonFieldMatches(&r, "s", `^[a-z]+-\d+$`)
+	r.expectNoErrors(t)
+
+	c.AssertJsonFieldMatches(&r, "s", "(")
+	r.expectError(t, `invalid pattern "("`)
+}
+
+func TestAssertJsonFieldOneOf(t *testing.T) {
+	c := jsonResponse(t, `{"n":5,"e":"green"}`)
+	var r fakeReporter
+	c.AssertJsonFieldOneOf(&r, "e", "red", "green")
+	c.AssertJsonFieldOneOf(&r, "n", 4, 5)
+	r.expectNoErrors(t)
+
+	c.AssertJsonFieldOneOf(&r, "e", "red", "blue")
+	r.expectError(t, `expected field "e" to be one of ["red","blue"], got "green"`)
+}
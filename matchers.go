@@ -0,0 +1,106 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Matcher checks a decoded JSON response body, returning an error describing
+// why it doesn't match. Matchers can be composed with And and Or to build up
+// reusable response assertions.
+type Matcher interface {
+	Match(actual interface{}) error
+}
+
+// MatcherFunc is an adapter allowing an ordinary function to be used as a
+// Matcher.
+type MatcherFunc func(actual interface{}) error
+
+func (f MatcherFunc) Match(actual interface{}) error {
+	return f(actual)
+}
+
+// AssertBodyMatch decodes the response body as JSON and checks it against m.
+func (c *CompletedRequest) AssertBodyMatch(t TestReporter, m Matcher) {
+	doc, err := c.decodeJson()
+	if err != nil {
+		t.Errorf("failed to unmarshal response json: %s", err)
+		return
+	}
+	if err := m.Match(doc); err != nil {
+		t.Errorf("response body doesn't match: %s", err)
+	}
+}
+
+// HasJsonField matches when the field at the given dotted path equals value,
+// after value has been converted to its JSON form. This means that, for
+// example, an int will match the equivalent JSON number.
+func HasJsonField(path string, value interface{}) Matcher {
+	return MatcherFunc(func(actual interface{}) error {
+		want, err := normalizeJson(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal expected value for field %q: %w", path, err)
+		}
+		got, ok := jsonField(actual, path)
+		if !ok {
+			return fmt.Errorf("field %q not found", path)
+		}
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Errorf("expected field %q to be %s, got %s", path, marshalForMessage(want), marshalForMessage(got))
+		}
+		return nil
+	})
+}
+
+// JsonArrayLen matches when the field at the given dotted path is an array
+// with n elements.
+func JsonArrayLen(path string, n int) Matcher {
+	return MatcherFunc(func(actual interface{}) error {
+		v, ok := jsonField(actual, path)
+		if !ok {
+			return fmt.Errorf("field %q not found", path)
+		}
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected field %q to be an array, got %s", path, jsonTypeName(v))
+		}
+		if len(arr) != n {
+			return fmt.Errorf("expected field %q to have %d elements, got %d", path, n, len(arr))
+		}
+		return nil
+	})
+}
+
+// And matches when all of the given matchers match. The first failure is
+// returned.
+func And(matchers ...Matcher) Matcher {
+	return MatcherFunc(func(actual interface{}) error {
+		for _, m := range matchers {
+			if err := m.Match(actual); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Or matches when at least one of the given matchers matches. If none do, the
+// returned error lists every failure.
+func Or(matchers ...Matcher) Matcher {
+	return MatcherFunc(func(actual interface{}) error {
+		if len(matchers) == 0 {
+			return errors.New("no matchers given to Or")
+		}
+		failures := make([]string, len(matchers))
+		for i, m := range matchers {
+			err := m.Match(actual)
+			if err == nil {
+				return nil
+			}
+			failures[i] = err.Error()
+		}
+		return fmt.Errorf("none of the alternatives matched: %s", strings.Join(failures, "; "))
+	})
+}
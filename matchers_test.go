@@ -0,0 +1,38 @@
+package testutil
+
+import (
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	c := jsonResponse(t, `{"name":"rex","tags":["a","b"],"age":3}`)
+	tests := []struct {
+		name string
+		m    Matcher
+		err  string
+	}{
+		{name: "field", m: HasJsonField("age", 3)},
+		{name: "field mismatch", m: HasJsonField("name", "max"), err: `expected field "name" to be "max", got "rex"`},
+		{name: "missing field", m: HasJsonField("owner", "x"), err: `field "owner" not found`},
+		{name: "array length", m: JsonArrayLen("tags", 2)},
+		{name: "array length mismatch", m: JsonArrayLen("tags", 3), err: `expected field "tags" to have 3 elements, got 2`},
+		{name: "not an array", m: JsonArrayLen("name", 1), err: `expected field "name" to be an array, got string`},
+		{name: "and", m: And(HasJsonField("name", "rex"), JsonArrayLen("tags", 2))},
+		{name: "and failure", m: And(HasJsonField("name", "rex"), HasJsonField("age", 4)), err: `expected field "age" to be 4, got 3`},
+		{name: "or", m: Or(HasJsonField("name", "max"), HasJsonField("name", "rex"))},
+		{name: "or failure", m: Or(HasJsonField("age", 1), HasJsonField("age", 2)), err: `none of the alternatives matched: expected field "age" to be 1, got 3; expected field "age" to be 2, got 3`},
+		{name: "empty or", m: Or(), err: "no matchers given to Or"},
+		{name: "func", m: MatcherFunc(func(interface{}) error { return nil })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r fakeReporter
+			c.AssertBodyMatch(&r, tt.m)
+			if tt.err == "" {
+				r.expectNoErrors(t)
+			} else {
+				r.expectError(t, "response body doesn't match: "+tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+)
+
+// WithRanges sets a Range header asking for each of the given byte ranges,
+// such as "bytes=0-99,200-299" for [2]int64{0, 99} and [2]int64{200, 299}.
+// Ends are inclusive, and a negative end asks for everything from the start
+// onwards.
+func (r *RequestBuilder) WithRanges(ranges ...[2]int64) *RequestBuilder {
+	if len(ranges) == 0 {
+		r.Error = errors.New("at least one byte range is required")
+		return r
+	}
+	specs := make([]string, len(ranges))
+	for i, rg := range ranges {
+		start, end := rg[0], rg[1]
+		switch {
+		case start < 0 || (end >= 0 && end < start):
+			r.Error = fmt.Errorf("invalid byte range %d-%d", start, end)
+			return r
+		case end < 0:
+			specs[i] = strconv.FormatInt(start, 10) + "-"
+		default:
+			specs[i] = strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10)
+		}
+	}
+	return r.WithHeader("Range", "bytes="+strings.Join(specs, ","))
+}
+
+// EachByteRange calls fn with the Content-Range and data of each part of a
+// multipart/byteranges response, as served for a request for several ranges,
+// in order. A response with a single range isn't multipart, so fn is called
+// once with the response's own Content-Range and body. If fn returns an
+// error, parsing stops and the error is returned.
+func (c *CompletedRequest) EachByteRange(fn func(contentRange string, data []byte) error) error {
+	body := c.Recorder.Body.Bytes()
+	mediaType, params, err := mime.ParseMediaType(c.Recorder.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		contentRange := c.Recorder.Header().Get("Content-Range")
+		if contentRange == "" {
+			return fmt.Errorf("expected a multipart/byteranges response or a Content-Range header, got Content-Type %q", c.Recorder.Header().Get("Content-Type"))
+		}
+		return fn(contentRange, body)
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return errors.New("multipart/byteranges response has no boundary")
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read byte range: %w", err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return fmt.Errorf("failed to read byte range: %w", err)
+		}
+		if err := fn(part.Header.Get("Content-Range"), data); err != nil {
+			return err
+		}
+	}
+}
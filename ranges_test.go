@@ -0,0 +1,78 @@
+package testutil
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rangeContent serves a fixed body with http.ServeContent, which handles
+// Range requests.
+var rangeContent = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader("0123456789"))
+})
+
+func TestWithRanges(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithRanges([2]int64{0, 99}, [2]int64{200, -1}))
+	if got := req.Header.Get("Range"); got != "bytes=0-99,200-" {
+		t.Errorf("unexpected Range header %q", got)
+	}
+	expectBuildError(t, NewRequest().Get("/").WithRanges(), "at least one byte range is required")
+	expectBuildError(t, NewRequest().Get("/").WithRanges([2]int64{5, 4}), "invalid byte range 5-4")
+	expectBuildError(t, NewRequest().Get("/").WithRanges([2]int64{-1, 4}), "invalid byte range -1-4")
+}
+
+func TestEachByteRange(t *testing.T) {
+	c := NewRequest().Get("/").WithRanges([2]int64{0, 1}, [2]int64{8, -1}).GoWithHTTPHandler(t, rangeContent)
+	c.AssertStatus(t, http.StatusPartialContent)
+
+	var got []string
+	err := c.EachByteRange(func(contentRange string, data []byte) error {
+		got = append(got, contentRange+" "+string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "bytes 0-1/10 01,bytes 8-9/10 89" {
+		t.Errorf("unexpected ranges %q", got)
+	}
+}
+
+func TestEachByteRangeSingleRange(t *testing.T) {
+	c := NewRequest().Get("/").WithRanges([2]int64{2, 4}).GoWithHTTPHandler(t, rangeContent)
+	var got []string
+	err := c.EachByteRange(func(contentRange string, data []byte) error {
+		got = append(got, contentRange+" "+string(data))
+		return nil
+	})
+	if err != nil || len(got) != 1 || got[0] != "bytes 2-4/10 234" {
+		t.Errorf("unexpected ranges %q, %v", got, err)
+	}
+}
+
+func TestEachByteRangeErrors(t *testing.T) {
+	err := get(t, respond("text/plain", "x")).EachByteRange(func(string, []byte) error { return nil })
+	if err == nil || !strings.HasPrefix(err.Error(), "expected a multipart/byteranges response") {
+		t.Errorf("expected an error for a full response, got %v", err)
+	}
+
+	err = get(t, respond("multipart/byteranges", "")).EachByteRange(func(string, []byte) error { return nil })
+	if err == nil || err.Error() != "multipart/byteranges response has no boundary" {
+		t.Errorf("expected a missing boundary error, got %v", err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	c := NewRequest().Get("/").WithRanges([2]int64{0, 1}, [2]int64{8, 9}).GoWithHTTPHandler(t, rangeContent)
+	err = c.EachByteRange(func(string, []byte) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expected the callback's error after one call, got %v after %d", err, calls)
+	}
+}
@@ -0,0 +1,51 @@
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// NewRequestFromDump parses a request in HTTP/1.x wire format, such as the
+// output of httputil.DumpRequest, into a RequestBuilder. This allows traffic
+// captured elsewhere to be replayed through a handler.
+//
+// Both origin-form and absolute-form request lines are accepted, and chunked
+// bodies are decoded. Multiple values for a header are joined with ", ", and
+// cookies are moved out of the Cookie header and into the builder's cookies.
+func NewRequestFromDump(dump []byte) (*RequestBuilder, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(dump)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request dump: %w", err)
+	}
+	defer req.Body.Close()
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request dump body: %w", err)
+	}
+
+	r := NewRequest().WithMethod(req.Method, req.URL.RequestURI())
+	for _, c := range req.Cookies() {
+		r.WithCookie(c)
+	}
+	for h, v := range req.Header {
+		switch h {
+		case "Cookie", "Content-Length", "Transfer-Encoding":
+			// Cookies were handled above, and the length and encoding
+			// describe the dumped body, which we've already decoded.
+			continue
+		}
+		r.WithHeader(h, strings.Join(v, ", "))
+	}
+	if req.Host != "" {
+		r.WithHost(req.Host)
+	}
+	if len(body) > 0 {
+		r.WithBody(body)
+	}
+	return r, nil
+}
@@ -0,0 +1,105 @@
+package testutil
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewRequestFromDump(t *testing.T) {
+	dump := strings.Join([]string{
+		"POST /pets?kind=cat HTTP/1.1",
+		"Host: api.example.com",
+		"Content-Type: application/json",
+		"Content-Length: 13",
+		"Accept: text/plain",
+		"Accept: application/json",
+		"Cookie: session=abc; theme=dark",
+		"",
+		`{"name":"x"}` + "\n",
+	}, "\r\n")
+
+	r, err := NewRequestFromDump([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != http.MethodPost || r.Path != "/pets?kind=cat" {
+		t.Errorf("expected POST /pets?kind=cat, got %s %s", r.Method, r.Path)
+	}
+	if r.Host != "api.example.com" {
+		t.Errorf("expected host api.example.com, got %q", r.Host)
+	}
+	if got := r.Headers["Accept"]; got != "text/plain, application/json" {
+		t.Errorf("expected repeated headers to be joined, got %q", got)
+	}
+	if got := r.Headers["Content-Type"]; got != "application/json" {
+		t.Errorf("expected the content type to be kept, got %q", got)
+	}
+	for _, h := range []string{"Cookie", "Content-Length", "Host"} {
+		if _, ok := r.Headers[h]; ok {
+			t.Errorf("expected header %s not to be copied", h)
+		}
+	}
+	if len(r.Cookies) != 2 || r.Cookies[0].Name != "session" || r.Cookies[1].Value != "dark" {
+		t.Errorf("expected the cookies to be parsed, got %v", r.Cookies)
+	}
+	if string(r.Body) != `{"name":"x"}`+"\n" {
+		t.Errorf("expected the body, got %q", r.Body)
+	}
+}
+
+func TestNewRequestFromDumpAbsoluteFormAndChunked(t *testing.T) {
+	dump := "PUT http://api.example.com/items/1 HTTP/1.1\r\n" +
+		"Host: api.example.com\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"
+
+	r, err := NewRequestFromDump([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Path != "/items/1" {
+		t.Errorf("expected the path from the absolute URL, got %q", r.Path)
+	}
+	if string(r.Body) != "hello world" {
+		t.Errorf("expected the chunked body to be decoded, got %q", r.Body)
+	}
+	if _, ok := r.Headers["Transfer-Encoding"]; ok {
+		t.Error("expected Transfer-Encoding not to be copied")
+	}
+}
+
+func TestNewRequestFromDumpReplays(t *testing.T) {
+	r, err := NewRequestFromDump([]byte("DELETE /items/1 HTTP/1.1\r\nHost: example.com\r\nX-Trace: 1\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *http.Request
+	var body []byte
+	r.GoWithHTTPHandler(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		body, _ = io.ReadAll(req.Body)
+	}))
+	if got == nil {
+		t.Fatal("expected the handler to be called")
+	}
+	if got.Method != http.MethodDelete || got.URL.Path != "/items/1" || got.Header.Get("X-Trace") != "1" {
+		t.Errorf("expected the dumped request, got %s %s %v", got.Method, got.URL, got.Header)
+	}
+	if len(body) != 0 {
+		t.Errorf("expected no body, got %q", body)
+	}
+}
+
+func TestNewRequestFromDumpInvalid(t *testing.T) {
+	_, err := NewRequestFromDump([]byte("not a request"))
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to parse request dump: ") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+	_, err = NewRequestFromDump([]byte("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\n\r\nshort"))
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to read request dump body: ") {
+		t.Errorf("expected a body error, got %v", err)
+	}
+}
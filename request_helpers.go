@@ -25,19 +25,53 @@ package testutil
 //   err := response.UnmarshalBodyToObject(&response)
 import (
 	"bytes"
+	"compress/zlib"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type TestReporter interface {
 	Errorf(format string, args ...any)
 }
 
+// testLogger is implemented by TestReporters which can also log, such as
+// *testing.T, and is used for messages which shouldn't fail the test.
+type testLogger interface {
+	Logf(format string, args ...any)
+}
+
+// DefaultAccept, when not empty, is sent as the Accept header of requests
+// which don't set one, for suites where handlers negotiate content. It should
+// be set once, before any requests are made, for example in TestMain.
+var DefaultAccept string
+
+// JsonMarshal and JsonUnmarshal are used to encode JSON request bodies, such
+// as those built by WithJsonBody, and to decode JSON responses, so that an
+// alternative JSON library can be swapped in for the whole suite. Like
+// DefaultAccept, they should be set once, before any requests are made.
+// Strict decoding always uses encoding/json, since it relies on
+// json.Decoder's DisallowUnknownFields.
+var (
+	JsonMarshal   = json.Marshal
+	JsonUnmarshal = json.Unmarshal
+)
+
 func NewRequest() *RequestBuilder {
 	return &RequestBuilder{
 		Headers: make(map[string]string),
@@ -46,13 +80,43 @@ func NewRequest() *RequestBuilder {
 
 // RequestBuilder caches request settings as we build up the request.
 type RequestBuilder struct {
-	Method  string
-	Path    string
-	Headers map[string]string
-	Body    []byte
-	Error   error
-	Cookies []*http.Cookie
-	Context context.Context
+	Method   string
+	Path     string
+	RawQuery string
+	Host     string
+	Headers  map[string]string
+	Body     []byte
+	Error    error
+	Cookies  []*http.Cookie
+	Context  context.Context
+
+	// Logger, when set, receives lifecycle events for the request, which is
+	// handy when debugging flaky tests.
+	Logger func(format string, args ...any)
+
+	// MaxBodySize, when greater than zero, is the largest body in bytes that
+	// the request may be sent with.
+	MaxBodySize int
+
+	// RequestModifiers are run in order against the fully built request,
+	// just before it's served.
+	RequestModifiers []func(*http.Request)
+
+	// WrapResponseWriter, when set, wraps the recorder before the handler
+	// is called.
+	WrapResponseWriter func(http.ResponseWriter) http.ResponseWriter
+
+	// ResponseTee, when set, receives a copy of the response body.
+	ResponseTee io.Writer
+
+	// When TruncateBody is set, the request declares the full length of
+	// Body, but only its first TruncatedBodySize bytes can be read.
+	TruncateBody      bool
+	TruncatedBodySize int
+
+	// TokenProvider, if set, is called each time the request is performed to
+	// get a bearer token to send, which overrides any Authorization header.
+	TokenProvider func() (string, error)
 }
 
 // WithMethod sets the method and path
@@ -62,6 +126,31 @@ func (r *RequestBuilder) WithMethod(method string, path string) *RequestBuilder
 	return r
 }
 
+// WithAbsoluteURL sets the request target to an absolute URL, as proxies
+// receive it, rather than a path. The request's URL, Host and RequestURI are
+// all then taken from rawURL.
+func (r *RequestBuilder) WithAbsoluteURL(rawURL string) *RequestBuilder {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		r.Error = fmt.Errorf("failed to parse absolute url: %w", err)
+		return r
+	}
+	if !u.IsAbs() || u.Host == "" {
+		r.Error = fmt.Errorf("url %q is not absolute", rawURL)
+		return r
+	}
+	r.Path = rawURL
+	return r
+}
+
+// WithRawQuery sets the query string to raw exactly as given, without any
+// re-encoding, for handlers which are sensitive to encoding details such as
+// "+" versus "%20". It replaces any query included in the path.
+func (r *RequestBuilder) WithRawQuery(raw string) *RequestBuilder {
+	r.RawQuery = raw
+	return r
+}
+
 func (r *RequestBuilder) Get(path string) *RequestBuilder {
 	return r.WithMethod("GET", path)
 }
@@ -89,12 +178,54 @@ func (r *RequestBuilder) WithHeader(header, value string) *RequestBuilder {
 }
 
 func (r *RequestBuilder) WithJWSAuth(jws string) *RequestBuilder {
-	r.Headers["Authorization"] = "Bearer " + jws
+	return r.WithAuthorization("Bearer", jws)
+}
+
+// WithAuthorization sets the Authorization header to use the given scheme,
+// for APIs which use schemes other than Bearer, such as "Token" or "ApiKey".
+func (r *RequestBuilder) WithAuthorization(scheme, credentials string) *RequestBuilder {
+	return r.WithRawAuthorization(scheme + " " + credentials)
+}
+
+// WithTokenProvider sets a function which is called each time the request is
+// performed to get a fresh bearer token, for flows where tokens expire, such
+// as OAuth client credentials in integration tests. If fn fails, so does the
+// test, and the request isn't performed.
+func (r *RequestBuilder) WithTokenProvider(fn func() (string, error)) *RequestBuilder {
+	r.TokenProvider = fn
 	return r
 }
 
+// WithRawAuthorization sets the Authorization header to value verbatim, for
+// credentials obtained elsewhere, such as a captured NTLM or Negotiate token,
+// which handlers only need to validate.
+func (r *RequestBuilder) WithRawAuthorization(value string) *RequestBuilder {
+	return r.WithHeader("Authorization", value)
+}
+
+// WithJWTClaims sends an unsigned JWT carrying claims as a bearer token. The
+// token uses "alg": "none" and has an empty signature.
+//
+// WARNING: this is only for test handlers which deliberately skip signature
+// verification, such as in a dev mode. A handler which accepts these tokens
+// in production accepts forged credentials from anyone, so never enable
+// such a mode outside of tests.
+func (r *RequestBuilder) WithJWTClaims(claims map[string]interface{}) *RequestBuilder {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		r.Error = fmt.Errorf("failed to marshal jwt claims: %w", err)
+		return r
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	return r.WithJWSAuth(header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".")
+}
+
+// WithHost sets the host the request is addressed to, which handlers see as
+// the request's Host field. This is separate from the headers, as the Go
+// server never passes a Host header through to handlers.
 func (r *RequestBuilder) WithHost(value string) *RequestBuilder {
-	return r.WithHeader("Host", value)
+	r.Host = value
+	return r
 }
 
 func (r *RequestBuilder) WithContentType(value string) *RequestBuilder {
@@ -113,6 +244,130 @@ func (r *RequestBuilder) WithAcceptJson() *RequestBuilder {
 	return r.WithAccept("application/json")
 }
 
+// WithAcceptLanguage sets the Accept-Language header to the given language
+// tags, in order of preference.
+func (r *RequestBuilder) WithAcceptLanguage(langs ...string) *RequestBuilder {
+	return r.WithHeader("Accept-Language", strings.Join(langs, ", "))
+}
+
+// AcceptPref is a media type along with its quality value, for building a
+// weighted Accept header.
+type AcceptPref struct {
+	MediaType string
+	Q         float64
+}
+
+// WithAcceptQ sets an Accept header listing each media type with its q value,
+// such as "application/json;q=0.9, text/html;q=0.1". Each Q must be between 0
+// and 1.
+func (r *RequestBuilder) WithAcceptQ(pairs ...AcceptPref) *RequestBuilder {
+	values := make([]string, len(pairs))
+	for i, p := range pairs {
+		if !(p.Q >= 0 && p.Q <= 1) {
+			r.Error = fmt.Errorf("invalid q value %v for %s: must be between 0 and 1", p.Q, p.MediaType)
+			return r
+		}
+		q := strconv.FormatFloat(math.Round(p.Q*1000)/1000, 'f', -1, 64)
+		values[i] = p.MediaType + ";q=" + q
+	}
+	return r.WithAccept(strings.Join(values, ", "))
+}
+
+// WithIfMatch sets the If-Match header, for optimistic concurrency control.
+// The etag is sent as given, so it should include its quotes.
+func (r *RequestBuilder) WithIfMatch(etag string) *RequestBuilder {
+	return r.WithHeader("If-Match", etag)
+}
+
+// WithOrigin sets the Origin header, which CSRF protection checks against the
+// expected origin.
+func (r *RequestBuilder) WithOrigin(origin string) *RequestBuilder {
+	return r.WithHeader("Origin", origin)
+}
+
+// WithReferer sets the Referer header.
+func (r *RequestBuilder) WithReferer(ref string) *RequestBuilder {
+	return r.WithHeader("Referer", ref)
+}
+
+// WithCSRFToken sends a CSRF token in the given header, such as
+// X-CSRF-Token, as it differs between frameworks.
+func (r *RequestBuilder) WithCSRFToken(header, token string) *RequestBuilder {
+	return r.WithHeader(header, token)
+}
+
+// WithExpectContinue sets the Expect: 100-continue header, so that handlers'
+// handling of it can be tested. Note that the recorder can't model the 100
+// Continue interim response itself; handlers only see the header.
+func (r *RequestBuilder) WithExpectContinue() *RequestBuilder {
+	return r.WithHeader("Expect", "100-continue")
+}
+
+// WithPrefer sets the Prefer header, such as "respond-async" to ask an
+// endpoint to process the request asynchronously.
+func (r *RequestBuilder) WithPrefer(value string) *RequestBuilder {
+	return r.WithHeader("Prefer", value)
+}
+
+// WithConnectionClose sets the Connection: close header, and marks the
+// request as closing, as the Go server does when a client disables
+// keep-alive, so handlers see both r.Close and the header.
+func (r *RequestBuilder) WithConnectionClose() *RequestBuilder {
+	return r.WithHeader("Connection", "close").WithRequestModifier(func(req *http.Request) {
+		req.Close = true
+	})
+}
+
+// WithContentRange sets a Content-Range header of the form
+// "bytes start-end/total", as sent with each chunk of a resumable upload.
+// end is inclusive. A negative total is sent as "*", meaning the total size
+// isn't known yet.
+func (r *RequestBuilder) WithContentRange(start, end, total int64) *RequestBuilder {
+	if start < 0 || end < start || (total >= 0 && end >= total) {
+		r.Error = fmt.Errorf("invalid content range %d-%d/%d", start, end, total)
+		return r
+	}
+	size := "*"
+	if total >= 0 {
+		size = strconv.FormatInt(total, 10)
+	}
+	return r.WithHeader("Content-Range", fmt.Sprintf("bytes %d-%d/%s", start, end, size))
+}
+
+// WithTraceContext sets a W3C Trace Context traceparent header for the given
+// trace and span IDs, with version 00 and the sampled flag set. The trace ID
+// must be 32 lowercase hex characters, and the span ID 16, neither all zero.
+func (r *RequestBuilder) WithTraceContext(traceID, spanID string) *RequestBuilder {
+	if err := validateTraceID("trace", traceID, 32); err != nil {
+		r.Error = err
+		return r
+	}
+	if err := validateTraceID("span", spanID, 16); err != nil {
+		r.Error = err
+		return r
+	}
+	return r.WithHeader("traceparent", "00-"+traceID+"-"+spanID+"-01")
+}
+
+// WithTraceState sets the W3C Trace Context tracestate header, which carries
+// vendor-specific data alongside traceparent.
+func (r *RequestBuilder) WithTraceState(state string) *RequestBuilder {
+	return r.WithHeader("tracestate", state)
+}
+
+func validateTraceID(kind, id string, length int) error {
+	if len(id) != length {
+		return fmt.Errorf("invalid %s id %q: must be %d hex characters", kind, id, length)
+	}
+	if strings.Trim(id, "0123456789abcdef") != "" {
+		return fmt.Errorf("invalid %s id %q: must be lowercase hex", kind, id)
+	}
+	if strings.Trim(id, "0") == "" {
+		return fmt.Errorf("invalid %s id %q: must not be all zeros", kind, id)
+	}
+	return nil
+}
+
 // Request body operations
 
 func (r *RequestBuilder) WithBody(body []byte) *RequestBuilder {
@@ -124,13 +379,179 @@ func (r *RequestBuilder) WithBody(body []byte) *RequestBuilder {
 // as the body with Content-Type: application/json
 func (r *RequestBuilder) WithJsonBody(obj interface{}) *RequestBuilder {
 	var err error
-	r.Body, err = json.Marshal(obj)
+	r.Body, err = JsonMarshal(obj)
+	if err != nil {
+		r.Error = fmt.Errorf("failed to marshal json object: %w", err)
+	}
+	return r.WithJsonContentType()
+}
+
+// WithJsonBodyMerged sends base as a JSON body, with the fields in overrides
+// replacing its own, which is handy for PATCH tests needing many variations
+// of one object. Nested objects are merged recursively, so overriding
+// {"address": {"city": "x"}} leaves the other address fields alone. Numbers
+// are kept exactly as base and overrides encode them, so large IDs survive.
+func (r *RequestBuilder) WithJsonBodyMerged(base interface{}, overrides map[string]interface{}) *RequestBuilder {
+	merged, err := decodeJsonValue(base)
 	if err != nil {
 		r.Error = fmt.Errorf("failed to marshal json object: %w", err)
+		return r
+	}
+	if _, ok := merged.(map[string]interface{}); !ok {
+		r.Error = fmt.Errorf("can't merge fields into a json %s", jsonTypeName(merged))
+		return r
+	}
+	patch, err := decodeJsonValue(overrides)
+	if err != nil {
+		r.Error = fmt.Errorf("failed to marshal json overrides: %w", err)
+		return r
+	}
+	return r.WithJsonBody(mergeJson(merged, patch))
+}
+
+// decodeJsonValue marshals v with JsonMarshal and decodes it into generic
+// JSON values, with numbers as json.Number so they're re-encoded unchanged.
+func decodeJsonValue(v interface{}) (interface{}, error) {
+	buf, err := JsonMarshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	var decoded interface{}
+	err = d.Decode(&decoded)
+	return decoded, err
+}
+
+// mergeJson deep-merges patch into doc, where both are decoded JSON values.
+// Objects are merged key by key, and anything else in patch replaces what
+// was in doc.
+func mergeJson(doc, patch interface{}) interface{} {
+	d, ok := doc.(map[string]interface{})
+	p, isObject := patch.(map[string]interface{})
+	if !ok || !isObject {
+		return patch
+	}
+	for k, v := range p {
+		d[k] = mergeJson(d[k], v)
+	}
+	return d
+}
+
+// WithJsonArrayStream sends a JSON array body, built from the items returned
+// by next until it reports there are no more. Each item is marshaled as soon
+// as next returns it, so a very large array doesn't have to be held in memory
+// as Go values all at once; only the encoded body is. For an array which
+// already exists as a slice, WithJsonBody is simpler.
+func (r *RequestBuilder) WithJsonArrayStream(next func() (item interface{}, ok bool)) *RequestBuilder {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; ; i++ {
+		item, ok := next()
+		if !ok {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		element, err := JsonMarshal(item)
+		if err != nil {
+			r.Error = fmt.Errorf("failed to marshal json array element %d: %w", i, err)
+			return r
+		}
+		buf.Write(element)
 	}
+	buf.WriteByte(']')
+	r.Body = buf.Bytes()
 	return r.WithJsonContentType()
 }
 
+// WithPreEncodedBody sends body exactly as given, with the given content type.
+// Unlike WithJsonBody nothing is marshaled, so canonical bytes from a fixture
+// reach the handler unchanged.
+func (r *RequestBuilder) WithPreEncodedBody(contentType string, body []byte) *RequestBuilder {
+	return r.WithBody(body).WithContentType(contentType)
+}
+
+// WithGeneratedBody sends a body of exactly size bytes, all set to fill, as
+// application/octet-stream, for testing size limits without large fixtures.
+func (r *RequestBuilder) WithGeneratedBody(size int, fill byte) *RequestBuilder {
+	if size < 0 {
+		r.Error = fmt.Errorf("can't generate a body of %d bytes", size)
+		return r
+	}
+	return r.WithPreEncodedBody("application/octet-stream", bytes.Repeat([]byte{fill}, size))
+}
+
+// WithGeneratedJsonBody sends a JSON object with fieldCount fields, named
+// field0, field1 and so on, each holding the string "value" followed by its
+// number, so the body is large but predictable.
+func (r *RequestBuilder) WithGeneratedJsonBody(fieldCount int) *RequestBuilder {
+	if fieldCount < 0 {
+		r.Error = fmt.Errorf("can't generate a json body with %d fields", fieldCount)
+		return r
+	}
+	fields := make(map[string]string, fieldCount)
+	for i := 0; i < fieldCount; i++ {
+		fields["field"+strconv.Itoa(i)] = "value" + strconv.Itoa(i)
+	}
+	return r.WithJsonBody(fields)
+}
+
+// WithTruncatedBody simulates an upload cut short, to test how handlers cope
+// with short reads. The request declares a Content-Length of len(full), but
+// reading the body fails with io.ErrUnexpectedEOF after sendBytes, just as it
+// does in the Go server when a client disconnects early.
+func (r *RequestBuilder) WithTruncatedBody(full []byte, sendBytes int) *RequestBuilder {
+	if sendBytes < 0 || sendBytes > len(full) {
+		r.Error = fmt.Errorf("can't send %d bytes of a %d byte body", sendBytes, len(full))
+		return r
+	}
+	r.Body = full
+	r.TruncateBody = true
+	r.TruncatedBodySize = sendBytes
+	return r
+}
+
+// truncatedReader reads from r, then fails with io.ErrUnexpectedEOF instead
+// of io.EOF.
+type truncatedReader struct {
+	r io.Reader
+}
+
+func (t *truncatedReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// WithDeflateBody compresses the body set so far as a zlib stream, and sets
+// Content-Encoding: deflate. Call it after setting the body.
+func (r *RequestBuilder) WithDeflateBody() *RequestBuilder {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(r.Body); err != nil {
+		r.Error = fmt.Errorf("failed to deflate body: %w", err)
+		return r
+	}
+	if err := w.Close(); err != nil {
+		r.Error = fmt.Errorf("failed to deflate body: %w", err)
+		return r
+	}
+	r.Body = buf.Bytes()
+	return r.WithHeader("Content-Encoding", "deflate")
+}
+
+// WithMaxRequestBodySize fails the request before it's served if the body
+// ends up larger than n bytes. This guards against fixtures which marshal to
+// something unexpectedly large.
+func (r *RequestBuilder) WithMaxRequestBodySize(n int) *RequestBuilder {
+	r.MaxBodySize = n
+	return r
+}
+
 // WithCookie sets a cookie
 func (r *RequestBuilder) WithCookie(c *http.Cookie) *RequestBuilder {
 	r.Cookies = append(r.Cookies, c)
@@ -141,30 +562,310 @@ func (r *RequestBuilder) WithCookieNameValue(name, value string) *RequestBuilder
 	return r.WithCookie(&http.Cookie{Name: name, Value: value})
 }
 
+// WithSessionCookie adds a cookie with the attributes a session cookie would
+// usually be set with: HttpOnly, Secure and SameSite=Lax. Note that browsers
+// only send a cookie's name and value, and so does the request; the
+// attributes are kept on the builder's Cookies for code which inspects them.
+func (r *RequestBuilder) WithSessionCookie(name, value string) *RequestBuilder {
+	return r.WithCookie(&http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// WithExpiringCookie adds a cookie which expires after maxAge seconds. As
+// with WithSessionCookie, only the name and value are sent with the request.
+func (r *RequestBuilder) WithExpiringCookie(name, value string, maxAge int) *RequestBuilder {
+	return r.WithCookie(&http.Cookie{
+		Name:    name,
+		Value:   value,
+		Path:    "/",
+		MaxAge:  maxAge,
+		Expires: time.Now().Add(time.Duration(maxAge) * time.Second),
+	})
+}
+
+// WithCookies adds a batch of cookies.
+func (r *RequestBuilder) WithCookies(cookies ...*http.Cookie) *RequestBuilder {
+	r.Cookies = append(r.Cookies, cookies...)
+	return r
+}
+
+// WithCookieMap adds a cookie for each name and value in m, in order of name.
+func (r *RequestBuilder) WithCookieMap(m map[string]string) *RequestBuilder {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.WithCookieNameValue(name, m[name])
+	}
+	return r
+}
+
+// WithCookieHeader parses a raw Cookie header, such as "a=1; b=2" copied from
+// a browser session, and adds each cookie in it.
+func (r *RequestBuilder) WithCookieHeader(raw string) *RequestBuilder {
+	for _, pair := range strings.Split(raw, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			r.Error = fmt.Errorf("malformed cookie %q: missing '='", pair)
+			return r
+		}
+		if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		c := &http.Cookie{Name: name, Value: value}
+		if err := c.Valid(); err != nil {
+			r.Error = fmt.Errorf("malformed cookie %q: %w", pair, err)
+			return r
+		}
+		r.WithCookie(c)
+	}
+	return r
+}
+
 func (r *RequestBuilder) WithContext(ctx context.Context) *RequestBuilder {
 	r.Context = ctx
 	return r
 }
 
+// WithRequestModifier adds a function which can make arbitrary changes to the
+// request just before it's served, for anything the builder doesn't model.
+// Modifiers run in the order they were added.
+func (r *RequestBuilder) WithRequestModifier(fn func(*http.Request)) *RequestBuilder {
+	r.RequestModifiers = append(r.RequestModifiers, fn)
+	return r
+}
+
+// WithResponseWriter sets a function which wraps the recorder before it's
+// passed to the handler, for example to add http.Flusher or http.Hijacker
+// shims which middleware expects. The CompletedRequest still reads the
+// response from the underlying recorder, so the wrapper must write through
+// to it.
+func (r *RequestBuilder) WithResponseWriter(fn func(http.ResponseWriter) http.ResponseWriter) *RequestBuilder {
+	r.WrapResponseWriter = fn
+	return r
+}
+
+// WithResponseTee copies the response body to w once the handler has run,
+// which is useful for logging it while debugging. The body is left in the
+// recorder, so it can still be decoded afterwards.
+func (r *RequestBuilder) WithResponseTee(w io.Writer) *RequestBuilder {
+	r.ResponseTee = w
+	return r
+}
+
+// WithLogger sets a function which is called with a message for each step
+// of performing the request. Passing t.Logf is usually what you want.
+func (r *RequestBuilder) WithLogger(fn func(format string, args ...any)) *RequestBuilder {
+	r.Logger = fn
+	return r
+}
+
+func (r *RequestBuilder) logf(format string, args ...any) {
+	if r.Logger != nil {
+		r.Logger(format, args...)
+	}
+}
+
+// GoRecovering performs the request like GoWithHTTPHandler, but recovers if
+// the handler panics instead of crashing the test. The returned
+// CompletedRequest is flagged as panicked, and the panic is logged with its
+// stack.
+//
+// A panic doesn't fail the test by itself, since GoRecovering is also how
+// tests check that a handler panics when it should. Always follow it with
+// AssertPanicked or AssertNoPanic to state what the test expects.
+func (r *RequestBuilder) GoRecovering(t TestReporter, handler http.Handler) *CompletedRequest {
+	var (
+		panicked   bool
+		panicValue interface{}
+		panicStack []byte
+	)
+	recovering := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// recover() returns nil for panic(nil), so rather than relying on the
+		// value, note whether ServeHTTP returned normally.
+		returned := false
+		defer func() {
+			if !returned {
+				panicValue, panicStack = recover(), debug.Stack()
+				panicked = true
+			}
+		}()
+		handler.ServeHTTP(w, req)
+		returned = true
+	})
+
+	c := r.GoWithHTTPHandler(t, recovering)
+	if c == nil || !panicked {
+		return c
+	}
+	r.logf("handler panicked: %v", panicValue)
+	if l, ok := t.(testLogger); ok {
+		l.Logf("handler panicked: %v\n%s", panicValue, panicStack)
+	}
+	c.Panicked = true
+	c.PanicValue = panicValue
+	c.PanicStack = panicStack
+	return c
+}
+
+// GoWithInspect performs the request against middleware wrapping an inner
+// handler, then calls inspect with the request the inner handler received,
+// so that tests can check what middleware changed, such as headers it added.
+// This works for middleware which passes on a modified clone of the request,
+// as well as middleware which modifies it in place. The test fails, and
+// inspect isn't called, if the middleware doesn't call the inner handler.
+func (r *RequestBuilder) GoWithInspect(t TestReporter, middleware func(http.Handler) http.Handler, inspect func(*http.Request)) *CompletedRequest {
+	c, inner := r.goWithInner(t, middleware)
+	if c == nil {
+		return nil
+	}
+	if inner == nil {
+		t.Errorf("expected middleware to call the inner handler, but it didn't, responding with status %d", c.Code())
+		return c
+	}
+	inspect(inner)
+	return c
+}
+
+// GoAssertInnerNotCalled performs the request against middleware wrapping an
+// inner handler, and checks that the inner handler wasn't called, meaning the
+// middleware short-circuited the request, as auth or rate limiting middleware
+// should when it rejects one. The response the middleware wrote is returned.
+func (r *RequestBuilder) GoAssertInnerNotCalled(t TestReporter, middleware func(http.Handler) http.Handler) *CompletedRequest {
+	c, inner := r.goWithInner(t, middleware)
+	if c != nil && inner != nil {
+		t.Errorf("expected middleware to handle the request itself, but it called the inner handler")
+	}
+	return c
+}
+
+// GoAssertInnerCalled is the opposite of GoAssertInnerNotCalled, checking
+// that the middleware let the request through to the inner handler.
+func (r *RequestBuilder) GoAssertInnerCalled(t TestReporter, middleware func(http.Handler) http.Handler) *CompletedRequest {
+	c, inner := r.goWithInner(t, middleware)
+	if c != nil && inner == nil {
+		t.Errorf("expected middleware to call the inner handler, but it didn't, responding with status %d", c.Code())
+	}
+	return c
+}
+
+// goWithInner performs the request against middleware wrapping an inner
+// handler which does nothing, and returns the request the inner handler
+// received, which is nil if the middleware didn't call it.
+func (r *RequestBuilder) goWithInner(t TestReporter, middleware func(http.Handler) http.Handler) (*CompletedRequest, *http.Request) {
+	var received *http.Request
+	inner := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = req
+	})
+	c := r.GoWithHTTPHandler(t, middleware(inner))
+	return c, received
+}
+
+// Validate checks the builder for configuration mistakes which would
+// otherwise produce a confusing request, such as a missing method or path.
+func (r *RequestBuilder) Validate() error {
+	if r.Method == "" {
+		return errors.New("request method is not set")
+	}
+	if r.Path == "" {
+		return errors.New("request path is not set")
+	}
+	if !strings.HasPrefix(r.Path, "/") && r.Path != "*" && !strings.Contains(r.Path, "://") {
+		return fmt.Errorf("request path %q must start with / or be an absolute URL", r.Path)
+	}
+	if r.TruncateBody && (r.TruncatedBodySize < 0 || r.TruncatedBodySize > len(r.Body)) {
+		return fmt.Errorf("can't send %d bytes of a %d byte body", r.TruncatedBodySize, len(r.Body))
+	}
+	return nil
+}
+
+// bodyWarning returns a warning if a body is set for a method whose requests
+// don't conventionally have one. This isn't a validation error, since some
+// handlers do read such bodies.
+func (r *RequestBuilder) bodyWarning() string {
+	if len(r.Body) == 0 {
+		return ""
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodTrace:
+		return fmt.Sprintf("warning: request body set on a %s request", r.Method)
+	}
+	return ""
+}
+
 // GoWithHTTPHandler performs the request, it takes a pointer to a testing context
 // to print messages, and a http handler for request handling.
 func (r *RequestBuilder) GoWithHTTPHandler(t TestReporter, handler http.Handler) *CompletedRequest {
+	if r.Error == nil {
+		if err := r.Validate(); err != nil {
+			r.Error = fmt.Errorf("invalid request: %w", err)
+		}
+	}
+	if r.Error == nil && r.MaxBodySize > 0 && len(r.Body) > r.MaxBodySize {
+		r.Error = fmt.Errorf("request body is %d bytes, exceeding the maximum of %d", len(r.Body), r.MaxBodySize)
+	}
 	if r.Error != nil {
 		// Fail the test if we had an error
+		r.logf("error constructing request: %s", r.Error)
 		t.Errorf("error constructing request: %s", r.Error)
 		return nil
 	}
+	var token string
+	if r.TokenProvider != nil {
+		var err error
+		if token, err = r.TokenProvider(); err != nil {
+			r.logf("failed to get token: %s", err)
+			t.Errorf("error constructing request: failed to get token: %s", err)
+			return nil
+		}
+	}
+	if w := r.bodyWarning(); w != "" {
+		r.logf("%s", w)
+		if l, ok := t.(testLogger); ok {
+			l.Logf("%s", w)
+		}
+	}
 	var bodyReader io.Reader
 	if r.Body != nil {
 		bodyReader = bytes.NewReader(r.Body)
 	}
+	if r.TruncateBody {
+		bodyReader = &truncatedReader{r: bytes.NewReader(r.Body[:r.TruncatedBodySize])}
+	}
 
 	req := httptest.NewRequest(r.Method, r.Path, bodyReader)
+	if r.RawQuery != "" {
+		req.URL.RawQuery = r.RawQuery
+		target, _, _ := strings.Cut(req.RequestURI, "?")
+		req.RequestURI = target + "?" + r.RawQuery
+	}
+	if r.TruncateBody {
+		req.ContentLength = int64(len(r.Body))
+		req.Header.Set("Content-Length", strconv.Itoa(len(r.Body)))
+	}
 	for h, v := range r.Headers {
 		req.Header.Add(h, v)
 	}
-	if host, ok := r.Headers["Host"]; ok {
-		req.Host = host
+	if r.TokenProvider != nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if DefaultAccept != "" && req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", DefaultAccept)
+	}
+	if r.Host != "" {
+		req.Host = r.Host
 	}
 	for _, c := range r.Cookies {
 		req.AddCookie(c)
@@ -172,14 +873,65 @@ func (r *RequestBuilder) GoWithHTTPHandler(t TestReporter, handler http.Handler)
 	if r.Context != nil {
 		req = req.WithContext(r.Context)
 	}
+	for _, modify := range r.RequestModifiers {
+		modify(req)
+	}
+	r.logf("built request: %s %s", req.Method, req.URL)
+
 	rec := httptest.NewRecorder()
-	handler.ServeHTTP(rec, req)
+	var w http.ResponseWriter = rec
+	if r.WrapResponseWriter != nil {
+		w = r.WrapResponseWriter(rec)
+	}
+	start := time.Now()
+	handler.ServeHTTP(w, req)
+	r.logf("served request in %s", time.Since(start))
+	r.logf("response status: %d %s", rec.Code, http.StatusText(rec.Code))
+	if r.ResponseTee != nil {
+		if _, err := r.ResponseTee.Write(rec.Body.Bytes()); err != nil {
+			t.Errorf("failed to tee response body: %s", err)
+		}
+	}
 
 	return &CompletedRequest{
 		Recorder: rec,
 	}
 }
 
+// DoJSON is a one-call helper for the typical JSON API test. It sends body as
+// JSON with the given method and path, and returns the decoded response body
+// along with the status code. A nil body, such as a nil pointer or map, isn't
+// sent at all, which suits GET and DELETE requests. Any other body is sent,
+// even a zero struct. Errors along the way fail the test, returning the zero
+// value of Resp. Responses without a body are left undecoded.
+func DoJSON[Req, Resp any](t TestReporter, handler http.Handler, method, path string, body Req) (Resp, int) {
+	var resp Resp
+	r := NewRequest().WithMethod(method, path).WithAcceptJson()
+	if !isNilBody(reflect.ValueOf(&body).Elem()) {
+		r.WithJsonBody(body)
+	}
+	c := r.GoWithHTTPHandler(t, handler)
+	if c == nil {
+		return resp, 0
+	}
+	if c.Recorder.Body.Len() == 0 {
+		return resp, c.Code()
+	}
+	if err := c.UnmarshalBodyToObject(&resp); err != nil {
+		t.Errorf("failed to unmarshal response: %s", err)
+	}
+	return resp, c.Code()
+}
+
+// isNilBody reports whether v is a nil pointer, map, slice or interface.
+func isNilBody(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
 // CompletedRequest is the result of calling Go() on the request builder. We're wrapping the
 // ResponseRecorder with some nice helper functions.
 type CompletedRequest struct {
@@ -188,6 +940,13 @@ type CompletedRequest struct {
 	// When set to true, decoders will be more strict. In the default JSON
 	// recorder, unknown fields will cause errors.
 	Strict bool
+
+	// Panicked is set when the request was performed with GoRecovering and
+	// the handler panicked. PanicValue and PanicStack then hold the value
+	// passed to panic and the stack trace at the time.
+	Panicked   bool
+	PanicValue interface{}
+	PanicStack []byte
 }
 
 func (c *CompletedRequest) DisallowUnknownFields() {
@@ -195,28 +954,185 @@ func (c *CompletedRequest) DisallowUnknownFields() {
 }
 
 // UnmarshalBodyToObject takes a destination object as input, and unmarshals the object
-// in the response based on the Content-Type header.
+// in the response based on the Content-Type header. Bodies with a
+// Content-Encoding are decoded first, using the registered ContentDecoders.
 func (c *CompletedRequest) UnmarshalBodyToObject(obj interface{}) error {
-	ctype := c.Recorder.Header().Get("Content-Type")
+	return c.unmarshalBody(c.Recorder.Body, obj)
+}
 
-	// Content type can have an annotation after ;
-	contentParts := strings.Split(ctype, ";")
-	content := strings.TrimSpace(contentParts[0])
+// unmarshalBody implements UnmarshalBodyToObject, reading the response body
+// from body. Passing a reader over the buffered bytes leaves the recorder's
+// body intact for other helpers.
+func (c *CompletedRequest) unmarshalBody(raw io.Reader, obj interface{}) error {
+	ctype := c.Recorder.Header().Get("Content-Type")
+	content := c.ContentType()
 	handler := getHandler(content)
 	if handler == nil {
 		return fmt.Errorf("unhandled content: %s", content)
 	}
 
-	return handler(ctype, c.Recorder.Body, obj, c.Strict)
+	body, err := c.decodeBody(raw)
+	if err != nil {
+		return err
+	}
+	return handler(ctype, body, obj, c.Strict)
+}
+
+// decodeBody wraps body, which is read from the response, in a reader which
+// undoes any Content-Encoding. Encodings are listed in the order they were
+// applied, so they're decoded in reverse.
+func (c *CompletedRequest) decodeBody(body io.Reader) (io.Reader, error) {
+	encodings := strings.Split(c.Recorder.Header().Get("Content-Encoding"), ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+		decoder := getDecoder(encoding)
+		if decoder == nil {
+			return nil, fmt.Errorf("unhandled content encoding: %s", encoding)
+		}
+		var err error
+		if body, err = decoder(body); err != nil {
+			return nil, fmt.Errorf("failed to decode %s content: %w", encoding, err)
+		}
+	}
+	return body, nil
 }
 
 // UnmarshalJsonToObject assumes that the response contains JSON and unmarshals it
 // into the specified object.
 func (c *CompletedRequest) UnmarshalJsonToObject(obj interface{}) error {
-	return json.Unmarshal(c.Recorder.Body.Bytes(), obj)
+	return JsonUnmarshal(c.Recorder.Body.Bytes(), obj)
+}
+
+// JsonDecoder returns a json.Decoder reading from the response body, for
+// decoding large or unusual bodies a token or element at a time. If Strict is
+// set, unknown fields are disallowed. Reading from the decoder consumes the
+// body, so other helpers reading it afterwards will only see what's left.
+func (c *CompletedRequest) JsonDecoder() *json.Decoder {
+	d := json.NewDecoder(c.Recorder.Body)
+	if c.Strict {
+		d.DisallowUnknownFields()
+	}
+	return d
 }
 
 // Code is a shortcut for response code
 func (c *CompletedRequest) Code() int {
 	return c.Recorder.Code
 }
+
+// Raw returns the underlying ResponseRecorder, for assertions which the
+// helpers here don't cover. It's the same as the Recorder field.
+func (c *CompletedRequest) Raw() *httptest.ResponseRecorder {
+	return c.Recorder
+}
+
+// BodySHA256 returns the hex-encoded SHA-256 digest of the raw response body.
+func (c *CompletedRequest) BodySHA256() string {
+	sum := sha256.Sum256(c.Recorder.Body.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// HeaderKeys returns the names of all the response headers, sorted.
+func (c *CompletedRequest) HeaderKeys() []string {
+	keys := make([]string, 0, len(c.Recorder.Header()))
+	for k := range c.Recorder.Header() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CacheControl parses the response's Cache-Control header into its
+// directives. Directive names are lowercased, directives without a value map
+// to an empty string, and quoted values are unquoted. For example,
+// "public, max-age=3600" gives {"public": "", "max-age": "3600"}.
+func (c *CompletedRequest) CacheControl() map[string]string {
+	directives := make(map[string]string)
+	raw := strings.Join(c.Recorder.Header().Values("Cache-Control"), ",")
+	for _, d := range splitQuoted(raw, ',') {
+		name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		value = unquoteHeaderValue(strings.TrimSpace(value))
+		directives[name] = value
+	}
+	return directives
+}
+
+// splitQuoted splits s on sep, except where sep appears inside a
+// double-quoted string.
+func splitQuoted(s string, sep rune) []string {
+	var (
+		parts   []string
+		start   int
+		quoted  bool
+		escaped bool
+	)
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteHeaderValue unquotes a header parameter value if it's a quoted
+// string, and returns it unchanged otherwise.
+func unquoteHeaderValue(v string) string {
+	if strings.HasPrefix(v, `"`) {
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			return unquoted
+		}
+	}
+	return v
+}
+
+// ContentType returns the media type of the response's Content-Type header,
+// without parameters such as charset, so "application/json; charset=utf-8"
+// results in "application/json".
+func (c *CompletedRequest) ContentType() string {
+	ctype, _, _ := strings.Cut(c.Recorder.Header().Get("Content-Type"), ";")
+	return strings.TrimSpace(ctype)
+}
+
+// Location returns the response's Location header, such as where a created
+// resource lives, or the URL to poll after a 202 Accepted. It's returned as
+// sent, so a relative reference isn't resolved.
+func (c *CompletedRequest) Location() string {
+	return c.Recorder.Header().Get("Location")
+}
+
+// RetryAfter parses the Retry-After response header, which may either be a
+// number of seconds or an HTTP date, and returns how long the client should
+// wait before retrying. A date in the past results in zero. The bool result
+// is false if the header is missing or can't be parsed.
+func (c *CompletedRequest) RetryAfter() (time.Duration, bool) {
+	value := strings.TrimSpace(c.Recorder.Header().Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Until(date); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
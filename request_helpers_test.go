@@ -0,0 +1,935 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *RequestBuilder
+		err  string
+	}{
+		{"valid", NewRequest().Get("/a"), ""},
+		{"asterisk", NewRequest().WithMethod(http.MethodOptions, "*"), ""},
+		{"absolute", NewRequest().Get("http://example.com/a"), ""},
+		{"no method", NewRequest().WithMethod("", "/a"), "request method is not set"},
+		{"no path", NewRequest().WithMethod(http.MethodGet, ""), "request path is not set"},
+		{"relative path", NewRequest().Get("a"), `request path "a" must start with / or be an absolute URL`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.r.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			} else if err == nil || err.Error() != tt.err {
+				t.Errorf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+	expectBuildError(t, NewRequest().Get("a"), "error constructing request: invalid request: request path")
+}
+
+func TestBodyWarning(t *testing.T) {
+	var rep fakeReporter
+	NewRequest().Get("/").WithBody([]byte("x")).GoWithHTTPHandler(&rep, respond("", ""))
+	rep.expectNoErrors(t)
+	if len(rep.logs) != 1 || rep.logs[0] != "warning: request body set on a GET request" {
+		t.Errorf("expected a warning to be logged, got %q", rep.logs)
+	}
+
+	rep = fakeReporter{}
+	NewRequest().Post("/").WithBody([]byte("x")).GoWithHTTPHandler(&rep, respond("", ""))
+	if len(rep.logs) != 0 {
+		t.Errorf("expected no warning for POST, got %q", rep.logs)
+	}
+}
+
+func TestWithCookieHeader(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithCookieHeader(`a=1; b="two"; ;c=`))
+	for name, want := range map[string]string{"a": "1", "b": "two", "c": ""} {
+		c, err := req.Cookie(name)
+		if err != nil || c.Value != want {
+			t.Errorf("expected cookie %s=%q, got %v, %v", name, want, c, err)
+		}
+	}
+	expectBuildError(t, NewRequest().Get("/").WithCookieHeader("a=1; b"), `malformed cookie "b": missing '='`)
+	expectBuildError(t, NewRequest().Get("/").WithCookieHeader("a b=1"), `malformed cookie "a b=1": `)
+}
+
+func TestWithCookieMap(t *testing.T) {
+	r := NewRequest().Get("/").WithCookieMap(map[string]string{"b": "2", "a": "1"})
+	if len(r.Cookies) != 2 || r.Cookies[0].Name != "a" || r.Cookies[1].Name != "b" {
+		t.Errorf("expected cookies sorted by name, got %v", r.Cookies)
+	}
+}
+
+func TestWithAcceptQ(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithAcceptQ(
+		AcceptPref{MediaType: "application/json", Q: 1},
+		AcceptPref{MediaType: "text/html", Q: 0.12345},
+		AcceptPref{MediaType: "*/*", Q: 0},
+	))
+	if got := req.Header.Get("Accept"); got != "application/json;q=1, text/html;q=0.123, */*;q=0" {
+		t.Errorf("unexpected Accept header %q", got)
+	}
+	expectBuildError(t, NewRequest().Get("/").WithAcceptQ(AcceptPref{MediaType: "a/b", Q: 1.5}), "invalid q value 1.5 for a/b")
+}
+
+func TestWithTraceContext(t *testing.T) {
+	const traceID, spanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req, _ := capture(t, NewRequest().Get("/").WithTraceContext(traceID, spanID).WithTraceState("k=v"))
+	if got := req.Header.Get("traceparent"); got != "00-"+traceID+"-"+spanID+"-01" {
+		t.Errorf("unexpected traceparent %q", got)
+	}
+	if got := req.Header.Get("tracestate"); got != "k=v" {
+		t.Errorf("unexpected tracestate %q", got)
+	}
+
+	tests := []struct{ traceID, spanID, err string }{
+		{"abc", spanID, "must be 32 hex characters"},
+		{strings.ToUpper(traceID), spanID, "must be lowercase hex"},
+		{strings.Repeat("0", 32), spanID, "must not be all zeros"},
+		{traceID, strings.Repeat("0", 16), `invalid span id "0000000000000000": must not be all zeros`},
+	}
+	for _, tt := range tests {
+		expectBuildError(t, NewRequest().Get("/").WithTraceContext(tt.traceID, tt.spanID), tt.err)
+	}
+}
+
+func TestWithContentRange(t *testing.T) {
+	tests := []struct {
+		start, end, total int64
+		want, err         string
+	}{
+		{start: 0, end: 99, total: 200, want: "bytes 0-99/200"},
+		{start: 100, end: 199, total: -1, want: "bytes 100-199/*"},
+		{start: 5, end: 4, total: 10, err: "invalid content range 5-4/10"},
+		{start: 0, end: 10, total: 10, err: "invalid content range 0-10/10"},
+		{start: -1, end: 1, total: 10, err: "invalid content range -1-1/10"},
+	}
+	for _, tt := range tests {
+		r := NewRequest().Put("/").WithContentRange(tt.start, tt.end, tt.total)
+		if tt.err != "" {
+			expectBuildError(t, r, tt.err)
+			continue
+		}
+		req, _ := capture(t, r)
+		if got := req.Header.Get("Content-Range"); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestWithTruncatedBody(t *testing.T) {
+	var body []byte
+	var readErr error
+	var length int64
+	NewRequest().Post("/").WithTruncatedBody([]byte("hello world"), 5).GoWithHTTPHandler(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		length = req.ContentLength
+		body, readErr = io.ReadAll(req.Body)
+	}))
+	if length != 11 {
+		t.Errorf("expected the full Content-Length, got %d", length)
+	}
+	if string(body) != "hello" || !errors.Is(readErr, io.ErrUnexpectedEOF) {
+		t.Errorf("expected a short read, got %q, %v", body, readErr)
+	}
+	expectBuildError(t, NewRequest().Post("/").WithTruncatedBody([]byte("ab"), 3), "can't send 3 bytes of a 2 byte body")
+
+	r := &RequestBuilder{Method: "POST", Path: "/", Body: []byte("ab"), TruncateBody: true, TruncatedBodySize: 3}
+	if err := r.Validate(); err == nil || err.Error() != "can't send 3 bytes of a 2 byte body" {
+		t.Errorf("expected Validate to reject the size, got %v", err)
+	}
+}
+
+func TestWithMaxRequestBodySize(t *testing.T) {
+	capture(t, NewRequest().Post("/").WithBody([]byte("abc")).WithMaxRequestBodySize(3))
+	expectBuildError(t, NewRequest().Post("/").WithBody([]byte("abcd")).WithMaxRequestBodySize(3),
+		"request body is 4 bytes, exceeding the maximum of 3")
+}
+
+func TestWithGeneratedBodies(t *testing.T) {
+	req, body := capture(t, NewRequest().Post("/").WithGeneratedBody(4, 'x'))
+	if string(body) != "xxxx" || req.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("unexpected generated body %q", body)
+	}
+	expectBuildError(t, NewRequest().Post("/").WithGeneratedBody(-1, 'x'), "can't generate a body of -1 bytes")
+
+	_, body = capture(t, NewRequest().Post("/").WithGeneratedJsonBody(2))
+	if string(body) != `{"field0":"value0","field1":"value1"}` {
+		t.Errorf("unexpected generated json body %q", body)
+	}
+	expectBuildError(t, NewRequest().Post("/").WithGeneratedJsonBody(-2), "can't generate a json body with -2 fields")
+}
+
+func TestWithJsonBodyMerged(t *testing.T) {
+	type address struct {
+		City   string `json:"city"`
+		Street string `json:"street"`
+	}
+	base := struct {
+		Name    string  `json:"name"`
+		Age     int     `json:"age"`
+		Address address `json:"address"`
+	}{"a", 3, address{"x", "y"}}
+
+	_, body := capture(t, NewRequest().Patch("/").WithJsonBodyMerged(base, map[string]interface{}{
+		"age":     nil,
+		"address": map[string]interface{}{"city": "z"},
+		"extra":   []int{1},
+	}))
+	want := `{"address":{"city":"z","street":"y"},"age":null,"extra":[1],"name":"a"}`
+	if string(body) != want {
+		t.Errorf("expected %s, got %s", want, body)
+	}
+	expectBuildError(t, NewRequest().Patch("/").WithJsonBodyMerged([]int{1}, nil), "can't merge fields into a json array")
+}
+
+func TestWithJsonBodyMergedKeepsNumbers(t *testing.T) {
+	base := struct {
+		ID    uint64  `json:"id"`
+		Price float64 `json:"price"`
+	}{9007199254740993, 0.1}
+	_, body := capture(t, NewRequest().Patch("/").WithJsonBodyMerged(base, map[string]interface{}{
+		"parent": int64(9007199254740995),
+	}))
+	want := `{"id":9007199254740993,"parent":9007199254740995,"price":0.1}`
+	if string(body) != want {
+		t.Errorf("expected %s, got %s", want, body)
+	}
+}
+
+func TestWithJsonBodyMergedUsesJsonMarshal(t *testing.T) {
+	defer func(m func(interface{}) ([]byte, error)) { JsonMarshal = m }(JsonMarshal)
+	var marshaled []string
+	JsonMarshal = func(v interface{}) ([]byte, error) {
+		buf, err := json.Marshal(v)
+		marshaled = append(marshaled, string(buf))
+		return buf, err
+	}
+
+	capture(t, NewRequest().Patch("/").WithJsonBodyMerged(map[string]int{"a": 1}, map[string]interface{}{"b": 2}))
+	want := []string{`{"a":1}`, `{"b":2}`, `{"a":1,"b":2}`}
+	if strings.Join(marshaled, " ") != strings.Join(want, " ") {
+		t.Errorf("expected JsonMarshal to encode %q, got %q", want, marshaled)
+	}
+}
+
+func TestWithJsonArrayStream(t *testing.T) {
+	i := 0
+	next := func() (interface{}, bool) {
+		i++
+		return map[string]int{"n": i}, i <= 3
+	}
+	req, body := capture(t, NewRequest().Post("/").WithJsonArrayStream(next))
+	if string(body) != `[{"n":1},{"n":2},{"n":3}]` {
+		t.Errorf("unexpected array body %s", body)
+	}
+	if req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected a JSON content type, got %q", req.Header.Get("Content-Type"))
+	}
+
+	_, body = capture(t, NewRequest().Post("/").WithJsonArrayStream(func() (interface{}, bool) { return nil, false }))
+	if string(body) != "[]" {
+		t.Errorf("expected an empty array, got %s", body)
+	}
+
+	bad := func() (interface{}, bool) { return func() {}, true }
+	expectBuildError(t, NewRequest().Post("/").WithJsonArrayStream(bad), "failed to marshal json array element 0")
+}
+
+func TestJsonMarshalHooks(t *testing.T) {
+	defer func(m func(interface{}) ([]byte, error), u func([]byte, interface{}) error) {
+		JsonMarshal, JsonUnmarshal = m, u
+	}(JsonMarshal, JsonUnmarshal)
+
+	marshaled, unmarshaled := 0, 0
+	JsonMarshal = func(v interface{}) ([]byte, error) {
+		marshaled++
+		return json.Marshal(v)
+	}
+	JsonUnmarshal = func(data []byte, v interface{}) error {
+		unmarshaled++
+		return json.Unmarshal(data, v)
+	}
+
+	_, body := capture(t, NewRequest().Post("/").WithJsonBody(map[string]int{"a": 1}))
+	if string(body) != `{"a":1}` || marshaled != 1 {
+		t.Errorf("expected JsonMarshal to encode the body, got %s after %d calls", body, marshaled)
+	}
+	var got map[string]int
+	if err := jsonResponse(t, `{"a":1}`).UnmarshalBodyToObject(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["a"] != 1 || unmarshaled != 1 {
+		t.Errorf("expected JsonUnmarshal to decode the body, got %v after %d calls", got, unmarshaled)
+	}
+}
+
+func TestWithJWTClaims(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithJWTClaims(map[string]interface{}{"sub": "user"}))
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		t.Fatalf("expected a bearer token, got %q", req.Header.Get("Authorization"))
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[2] != "" {
+		t.Fatalf("expected an unsigned JWT, got %q", token)
+	}
+	header, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if string(header) != `{"alg":"none","typ":"JWT"}` || string(payload) != `{"sub":"user"}` {
+		t.Errorf("unexpected token contents %s.%s", header, payload)
+	}
+	expectBuildError(t, NewRequest().Get("/").WithJWTClaims(map[string]interface{}{"bad": func() {}}), "failed to marshal jwt claims")
+}
+
+func TestWithTokenProvider(t *testing.T) {
+	n := 0
+	r := NewRequest().Get("/").WithAuthorization("Basic", "x").WithTokenProvider(func() (string, error) {
+		n++
+		return "token" + string(rune('0'+n)), nil
+	})
+	for _, want := range []string{"Bearer token1", "Bearer token2"} {
+		req, _ := capture(t, r)
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+	expectBuildError(t, NewRequest().Get("/").WithTokenProvider(func() (string, error) {
+		return "", errors.New("expired")
+	}), "error constructing request: failed to get token: expired")
+}
+
+func TestWithRawQuery(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/search?old=1").WithRawQuery("q=a+b%20c"))
+	if req.URL.RawQuery != "q=a+b%20c" || req.RequestURI != "/search?q=a+b%20c" {
+		t.Errorf("expected the raw query verbatim, got %q and %q", req.URL.RawQuery, req.RequestURI)
+	}
+	if got := NewRequest().Get("/search?q=old").WithRawQuery("q=a+b").BuildCurl("http://localhost:8080/"); got != `curl -X 'GET' 'http://localhost:8080/search?q=a+b'` {
+		t.Errorf("expected curl to use the raw query, got %s", got)
+	}
+}
+
+func TestWithAbsoluteURL(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithAbsoluteURL("http://example.com/a?b=1"))
+	if req.Host != "example.com" || req.URL.Path != "/a" || req.RequestURI != "http://example.com/a?b=1" {
+		t.Errorf("unexpected request %s %s %s", req.Host, req.URL, req.RequestURI)
+	}
+	expectBuildError(t, NewRequest().Get("/").WithAbsoluteURL("/relative"), `url "/relative" is not absolute`)
+}
+
+func TestWithConnectionClose(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithConnectionClose())
+	if !req.Close || req.Header.Get("Connection") != "close" {
+		t.Errorf("expected the request to be closing, got %v %q", req.Close, req.Header.Get("Connection"))
+	}
+}
+
+func TestDefaultAccept(t *testing.T) {
+	defer func(accept string) { DefaultAccept = accept }(DefaultAccept)
+	DefaultAccept = "application/vnd.api+json"
+
+	req, _ := capture(t, NewRequest().Get("/"))
+	if got := req.Header.Get("Accept"); got != DefaultAccept {
+		t.Errorf("expected the default Accept header, got %q", got)
+	}
+	req, _ = capture(t, NewRequest().Get("/").WithAccept("text/html"))
+	if got := req.Header.Get("Accept"); got != "text/html" {
+		t.Errorf("expected an explicit Accept header to win, got %q", got)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var logs []string
+	NewRequest().Get("/").
+		WithLogger(func(format string, args ...any) { logs = append(logs, format) }).
+		GoWithHTTPHandler(t, respond("text/plain", "hi"))
+	if len(logs) != 3 {
+		t.Errorf("expected three lifecycle messages, got %q", logs)
+	}
+}
+
+func TestWithResponseTee(t *testing.T) {
+	var tee strings.Builder
+	c := NewRequest().Get("/").
+		WithResponseTee(&tee).
+		GoWithHTTPHandler(t, respond("text/plain", "hi"))
+	if tee.String() != "hi" || c.Recorder.Body.String() != "hi" {
+		t.Errorf("expected the body to be teed and kept, got %q and %q", tee.String(), c.Recorder.Body.String())
+	}
+}
+
+type doJSONPet struct {
+	Name string `json:"name"`
+}
+
+func TestDoJSON(t *testing.T) {
+	var gotMethod, gotBody, gotType string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotBody, gotType = r.Method, string(body), r.Header.Get("Content-Type")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"name":"rex"}`))
+	})
+
+	pet, code := DoJSON[doJSONPet, doJSONPet](t, handler, http.MethodPost, "/pets", doJSONPet{Name: "rex"})
+	if code != http.StatusCreated || pet.Name != "rex" {
+		t.Errorf("expected the created pet, got %d %+v", code, pet)
+	}
+	if gotBody != `{"name":"rex"}` || gotType != "application/json" {
+		t.Errorf("expected a JSON body, got %q as %q", gotBody, gotType)
+	}
+
+	pet, code = DoJSON[*doJSONPet, doJSONPet](t, handler, http.MethodDelete, "/pets/1", nil)
+	if code != http.StatusNoContent || pet.Name != "" {
+		t.Errorf("expected an empty response, got %d %+v", code, pet)
+	}
+	if gotMethod != http.MethodDelete || gotBody != "" || gotType != "" {
+		t.Errorf("expected no body to be sent, got %q as %q", gotBody, gotType)
+	}
+
+	// Only nil bodies are left out; a zero struct is still sent, so handlers
+	// can be tested with an empty object.
+	_, _ = DoJSON[doJSONPet, doJSONPet](t, handler, http.MethodPost, "/pets", doJSONPet{})
+	if gotBody != `{"name":""}` || gotType != "application/json" {
+		t.Errorf("expected a zero body to be sent, got %q as %q", gotBody, gotType)
+	}
+	_, _ = DoJSON[map[string]int, doJSONPet](t, handler, http.MethodGet, "/pets", nil)
+	if gotBody != "" {
+		t.Errorf("expected a nil map not to be sent, got %q", gotBody)
+	}
+}
+
+func TestGoRecovering(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		value   interface{}
+	}{
+		{"value", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }), "boom"},
+		{"nil", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(nil) }), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rep fakeReporter
+			c := NewRequest().Get("/").GoRecovering(&rep, tt.handler)
+			rep.expectNoErrors(t)
+			if !c.Panicked || len(c.PanicStack) == 0 {
+				t.Fatal("expected the panic to be recorded")
+			}
+			// Since Go 1.21, panic(nil) panics with a *runtime.PanicNilError.
+			if tt.value != nil && c.PanicValue != tt.value {
+				t.Errorf("expected panic value %v, got %v", tt.value, c.PanicValue)
+			}
+			if len(rep.logs) != 1 || !strings.HasPrefix(rep.logs[0], "handler panicked: ") {
+				t.Errorf("expected the panic to be logged, got %q", rep.logs)
+			}
+		})
+	}
+
+	var rep fakeReporter
+	c := NewRequest().Get("/").GoRecovering(&rep, respond("", "ok"))
+	if c.Panicked || len(rep.logs) != 0 {
+		t.Errorf("expected no panic, got %v and %q", c.PanicValue, rep.logs)
+	}
+}
+
+func TestGoWithInspect(t *testing.T) {
+	cloning := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.Clone(r.Context())
+			r.Header.Set("X-User", "alice")
+			next.ServeHTTP(w, r)
+		})
+	}
+	var seen string
+	var rep fakeReporter
+	NewRequest().Get("/").GoWithInspect(&rep, cloning, func(r *http.Request) {
+		seen = r.Header.Get("X-User")
+	})
+	rep.expectNoErrors(t)
+	if seen != "alice" {
+		t.Errorf("expected the inner handler's request, got X-User %q", seen)
+	}
+
+	blocking := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+	inspected := false
+	NewRequest().Get("/").GoWithInspect(&rep, blocking, func(r *http.Request) { inspected = true })
+	rep.expectError(t, "expected middleware to call the inner handler, but it didn't, responding with status 401")
+	if inspected {
+		t.Error("expected inspect not to be called")
+	}
+}
+
+func TestGoAssertInnerCalled(t *testing.T) {
+	passing := func(next http.Handler) http.Handler { return next }
+	blocking := func(next http.Handler) http.Handler { return respond("", "") }
+
+	var rep fakeReporter
+	NewRequest().Get("/").GoAssertInnerCalled(&rep, passing)
+	NewRequest().Get("/").GoAssertInnerNotCalled(&rep, blocking)
+	rep.expectNoErrors(t)
+
+	NewRequest().Get("/").GoAssertInnerCalled(&rep, blocking)
+	rep.expectError(t, "expected middleware to call the inner handler")
+
+	rep = fakeReporter{}
+	NewRequest().Get("/").GoAssertInnerNotCalled(&rep, passing)
+	rep.expectError(t, "expected middleware to handle the request itself")
+}
+
+func TestContentType(t *testing.T) {
+	c := get(t, respond("Application/JSON ; charset=utf-8", ""))
+	if got := c.ContentType(); got != "Application/JSON" {
+		t.Errorf("unexpected content type %q", got)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	c := get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Cache-Control", `Public, max-age=3600`)
+		w.Header().Add("Cache-Control", `no-cache="Set-Cookie, X-Foo"`)
+	}))
+	cc := c.CacheControl()
+	if len(cc) != 3 || cc["public"] != "" || cc["max-age"] != "3600" || cc["no-cache"] != "Set-Cookie, X-Foo" {
+		t.Errorf("unexpected directives %q", cc)
+	}
+}
+
+func TestHeaderKeys(t *testing.T) {
+	c := get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Location", "/items/1")
+	}))
+	if got := c.HeaderKeys(); strings.Join(got, ",") != "Content-Type,Location,Retry-After" {
+		t.Errorf("unexpected header keys %q", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+		check func(time.Duration) bool
+	}{
+		{"", false, nil},
+		{"soon", false, nil},
+		{"-5", false, nil},
+		{"0", true, func(d time.Duration) bool { return d == 0 }},
+		{"120", true, func(d time.Duration) bool { return d == 2*time.Minute }},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), true, func(d time.Duration) bool { return d == 0 }},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), true, func(d time.Duration) bool { return d > 58*time.Minute && d <= time.Hour }},
+	}
+	for _, tt := range tests {
+		c := get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.value != "" {
+				w.Header().Set("Retry-After", tt.value)
+			}
+		}))
+		d, ok := c.RetryAfter()
+		if ok != tt.ok || (tt.check != nil && !tt.check(d)) {
+			t.Errorf("%q: unexpected result %v, %v", tt.value, d, ok)
+		}
+	}
+}
+
+func TestWithHost(t *testing.T) {
+	// Virtual hosts are routed on req.Host, which WithHost sets, while a Host
+	// entry in the headers is just another header, as the Go server never
+	// passes one through to handlers.
+	mux := http.NewServeMux()
+	mux.Handle("api.example.com/", respond("text/plain", "api"))
+	mux.Handle("/", respond("text/plain", "default"))
+
+	c := NewRequest().Get("/").WithHost("api.example.com").GoWithHTTPHandler(t, mux)
+	if got := c.Recorder.Body.String(); got != "api" {
+		t.Errorf("expected the api virtual host, got %q", got)
+	}
+
+	req, _ := capture(t, NewRequest().Get("/").WithHeader("Host", "header.example.com"))
+	if req.Host != "example.com" {
+		t.Errorf("expected a Host header not to change req.Host, got %q", req.Host)
+	}
+	c = NewRequest().Get("/").WithHeader("Host", "api.example.com").GoWithHTTPHandler(t, mux)
+	if got := c.Recorder.Body.String(); got != "default" {
+		t.Errorf("expected a Host header not to route to the virtual host, got %q", got)
+	}
+
+	req, _ = capture(t, NewRequest().Get("/").WithHeader("Host", "header.example.com").WithHost("api.example.com"))
+	if req.Host != "api.example.com" {
+		t.Errorf("expected WithHost to set req.Host, got %q", req.Host)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	c := get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("chunk"))
+		w.(http.Flusher).Flush()
+	}))
+	if c.Raw() != c.Recorder {
+		t.Error("expected Raw to return the recorder")
+	}
+	if !c.Raw().Flushed {
+		t.Error("expected Raw().Flushed to be set")
+	}
+}
+
+func TestWithRequestModifier(t *testing.T) {
+	var order []string
+	req, _ := capture(t, NewRequest().Get("/").WithHeader("X-Step", "builder").
+		WithRequestModifier(func(r *http.Request) {
+			order = append(order, "first:"+r.Header.Get("X-Step"))
+			r.Header.Set("X-Step", "first")
+		}).
+		WithRequestModifier(func(r *http.Request) {
+			order = append(order, "second:"+r.Header.Get("X-Step"))
+			r.Header.Set("X-Step", "second")
+			r.RemoteAddr = "10.0.0.1:1234"
+		}))
+	if strings.Join(order, ",") != "first:builder,second:first" {
+		t.Errorf("expected modifiers to run in order, got %q", order)
+	}
+	if req.Header.Get("X-Step") != "second" || req.RemoteAddr != "10.0.0.1:1234" {
+		t.Errorf("expected the last modifier's changes, got %q and %q", req.Header.Get("X-Step"), req.RemoteAddr)
+	}
+}
+
+func TestJsonDecoder(t *testing.T) {
+	c := jsonResponse(t, `[{"name":"a"},{"name":"b"},{"name":"c"}]`)
+	dec := c.JsonDecoder()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		t.Fatalf("expected the start of an array, got %v, %v", tok, err)
+	}
+	var names []string
+	for dec.More() {
+		var item struct{ Name string }
+		if err := dec.Decode(&item); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, item.Name)
+	}
+	if strings.Join(names, ",") != "a,b,c" {
+		t.Errorf("expected each element, got %q", names)
+	}
+}
+
+func TestJsonDecoderStrict(t *testing.T) {
+	body := `{"name":"a","age":1}`
+	var item struct{ Name string }
+	if err := jsonResponse(t, body).JsonDecoder().Decode(&item); err != nil || item.Name != "a" {
+		t.Errorf("expected unknown fields to be ignored, got %+v, %v", item, err)
+	}
+
+	c := jsonResponse(t, body)
+	c.DisallowUnknownFields()
+	err := c.JsonDecoder().Decode(&item)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "age"`) {
+		t.Errorf("expected an unknown field error, got %v", err)
+	}
+}
+
+// flushRecorder adds http.Flusher to a response writer which lacks it,
+// counting the flushes.
+type flushRecorder struct {
+	http.ResponseWriter
+	flushes int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes++
+}
+
+// noFlusher hides the recorder's own Flush method.
+type noFlusher struct {
+	w http.ResponseWriter
+}
+
+func (n noFlusher) Header() http.Header         { return n.w.Header() }
+func (n noFlusher) Write(b []byte) (int, error) { return n.w.Write(b) }
+func (n noFlusher) WriteHeader(code int)        { n.w.WriteHeader(code) }
+
+func TestWithResponseWriter(t *testing.T) {
+	var wrapper *flushRecorder
+	c := NewRequest().Get("/").
+		WithResponseWriter(func(w http.ResponseWriter) http.ResponseWriter {
+			wrapper = &flushRecorder{ResponseWriter: noFlusher{w}}
+			return wrapper
+		}).
+		GoWithHTTPHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f, ok := w.(http.Flusher)
+			if !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte("streamed"))
+			f.Flush()
+		}))
+	c.AssertStatus(t, http.StatusOK)
+	if wrapper.flushes != 1 {
+		t.Errorf("expected the wrapper to be flushed once, got %d", wrapper.flushes)
+	}
+	if got := c.Recorder.Body.String(); got != "streamed" {
+		t.Errorf("expected the body in the underlying recorder, got %q", got)
+	}
+}
+
+func TestWithDeflateBody(t *testing.T) {
+	inflating := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "deflate" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		zr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(zr)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+	c := NewRequest().Post("/").WithJsonBody(map[string]string{"name": "rex"}).WithDeflateBody().GoWithHTTPHandler(t, inflating)
+	c.AssertStatus(t, http.StatusOK)
+	var got map[string]string
+	if err := c.UnmarshalBodyToObject(&got); err != nil || got["name"] != "rex" {
+		t.Errorf("expected the body to round-trip, got %v, %v", got, err)
+	}
+}
+
+func TestCSRFHeaders(t *testing.T) {
+	csrf := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				origin = strings.TrimSuffix(r.Header.Get("Referer"), "/form")
+			}
+			if origin != "https://app.example.com" || r.Header.Get("X-CSRF-Token") != "secret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := csrf(respond("", ""))
+	tests := []struct {
+		name string
+		r    *RequestBuilder
+		want int
+	}{
+		{"origin and token", NewRequest().Post("/").WithOrigin("https://app.example.com").WithCSRFToken("X-CSRF-Token", "secret"), http.StatusOK},
+		{"referer and token", NewRequest().Post("/").WithReferer("https://app.example.com/form").WithCSRFToken("X-CSRF-Token", "secret"), http.StatusOK},
+		{"wrong origin", NewRequest().Post("/").WithOrigin("https://evil.example.com").WithCSRFToken("X-CSRF-Token", "secret"), http.StatusForbidden},
+		{"wrong token", NewRequest().Post("/").WithOrigin("https://app.example.com").WithCSRFToken("X-CSRF-Token", "guess"), http.StatusForbidden},
+		{"token in another header", NewRequest().Post("/").WithOrigin("https://app.example.com").WithCSRFToken("X-XSRF-Token", "secret"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.GoWithHTTPHandler(t, handler).AssertStatus(t, tt.want)
+		})
+	}
+}
+
+func TestBodySHA256(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0}
+	c := get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(png)
+	}))
+	sum := sha256.Sum256(png)
+	want := hex.EncodeToString(sum[:])
+	if got := c.BodySHA256(); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	var r fakeReporter
+	c.AssertBodySHA256(&r, strings.ToUpper(want))
+	r.expectNoErrors(t)
+	c.AssertBodySHA256(&r, strings.Repeat("0", 64))
+	r.expectError(t, "expected body sha256 "+strings.Repeat("0", 64)+", got "+want)
+}
+
+func TestWithSessionAndExpiringCookies(t *testing.T) {
+	r := NewRequest().Get("/").WithSessionCookie("session", "abc").WithExpiringCookie("remember", "1", 3600)
+	req, _ := capture(t, r)
+
+	// Only names and values are sent, as a browser would.
+	got := req.Cookies()
+	if len(got) != 2 || got[0].Name != "session" || got[0].Value != "abc" || got[1].Name != "remember" || got[1].Value != "1" {
+		t.Fatalf("expected both cookies to reach the handler, got %v", got)
+	}
+	if got[0].HttpOnly || got[1].MaxAge != 0 {
+		t.Errorf("expected no attributes to be sent, got %v", got)
+	}
+
+	session, remember := r.Cookies[0], r.Cookies[1]
+	if !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode || session.Path != "/" {
+		t.Errorf("expected session cookie attributes, got %+v", session)
+	}
+	if remember.MaxAge != 3600 || time.Until(remember.Expires) < 59*time.Minute {
+		t.Errorf("expected an expiry an hour away, got %+v", remember)
+	}
+}
+
+func TestWithCookies(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithCookieNameValue("first", "0").WithCookies(
+		&http.Cookie{Name: "a", Value: "1"},
+		&http.Cookie{Name: "b", Value: "2"},
+		&http.Cookie{Name: "c", Value: "3"},
+	))
+	var got []string
+	for _, c := range req.Cookies() {
+		got = append(got, c.Name+"="+c.Value)
+	}
+	if strings.Join(got, "; ") != "first=0; a=1; b=2; c=3" {
+		t.Errorf("expected every cookie to reach the handler, got %q", got)
+	}
+}
+
+func TestWithPreEncodedBody(t *testing.T) {
+	// Keys out of order and odd spacing would both be lost by re-marshaling.
+	raw := []byte("{\"z\": 1,  \"a\": [1.50, 2e3]}\n")
+	req, body := capture(t, NewRequest().Post("/").WithPreEncodedBody("application/merge-patch+json", raw))
+	if !bytes.Equal(body, raw) {
+		t.Errorf("expected the body byte for byte, got %q", body)
+	}
+	if got := req.Header.Get("Content-Type"); got != "application/merge-patch+json" {
+		t.Errorf("expected the given content type, got %q", got)
+	}
+}
+
+func TestWithIfMatch(t *testing.T) {
+	const current = `"v2"`
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") != current {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", `"v3"`)
+	})
+
+	var rep fakeReporter
+	NewRequest().Put("/items/1").WithIfMatch(`"v1"`).GoWithHTTPHandler(t, handler).AssertPreconditionFailed(&rep)
+	rep.expectNoErrors(t)
+
+	NewRequest().Put("/items/1").WithIfMatch(current).GoWithHTTPHandler(t, handler).AssertPreconditionFailed(&rep)
+	rep.expectError(t, "expected status 412 Precondition Failed, got 200 OK")
+}
+
+func TestWithAcceptLanguage(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, lang := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+			switch strings.TrimSpace(lang) {
+			case "fr":
+				w.Header().Set("Content-Language", "fr")
+				_, _ = w.Write([]byte("bonjour"))
+				return
+			case "en":
+				w.Header().Set("Content-Language", "en")
+				_, _ = w.Write([]byte("hello"))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotAcceptable)
+	})
+
+	tests := []struct {
+		langs []string
+		want  string
+		body  string
+	}{
+		{[]string{"fr", "en"}, "fr", "bonjour"},
+		{[]string{"de", "en", "fr"}, "en", "hello"},
+	}
+	for _, tt := range tests {
+		c := NewRequest().Get("/").WithAcceptLanguage(tt.langs...).GoWithHTTPHandler(t, handler)
+		c.AssertContentLanguage(t, tt.want)
+		if got := c.Recorder.Body.String(); got != tt.body {
+			t.Errorf("%q: expected %q, got %q", tt.langs, tt.body, got)
+		}
+	}
+	NewRequest().Get("/").WithAcceptLanguage("de").GoWithHTTPHandler(t, handler).AssertStatus(t, http.StatusNotAcceptable)
+}
+
+func TestWithExpectContinue(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Expect") != "100-continue" {
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+	c := NewRequest().Post("/upload").WithBody([]byte("large")).WithExpectContinue().GoWithHTTPHandler(t, handler)
+	c.AssertStatus(t, http.StatusOK)
+	if got := c.Recorder.Body.String(); got != "large" {
+		t.Errorf("expected the body to be read after the expectation, got %q", got)
+	}
+}
+
+func TestWithPrefer(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Prefer") == "respond-async" {
+			w.Header().Set("Location", "/jobs/42")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	var rep fakeReporter
+	c := NewRequest().Post("/reports").WithPrefer("respond-async").GoWithHTTPHandler(t, handler)
+	c.AssertAccepted(&rep)
+	rep.expectNoErrors(t)
+	if got := c.Location(); got != "/jobs/42" {
+		t.Errorf("expected the job to poll, got %q", got)
+	}
+
+	NewRequest().Post("/reports").GoWithHTTPHandler(t, handler).AssertAccepted(&rep)
+	rep.expectError(t, "expected status 202 Accepted, got 201 Created")
+}
+
+func TestWithRawAuthorization(t *testing.T) {
+	// An NTLM type 3 message, as captured from a real exchange, which must
+	// reach the handler untouched.
+	const token = "NTLM TlRMTVNTUAADAAAAGAAYAEAAAAAYABgAWAAAAAAAAABwAAAACAAIAHAAAAAIAAgAeAAAAAAAAAAAAAAABYKIogUBKAoAAAAP"
+	req, _ := capture(t, NewRequest().Get("/").WithRawAuthorization(token))
+	if got := req.Header.Get("Authorization"); got != token {
+		t.Errorf("expected the token verbatim, got %q", got)
+	}
+}
+
+func TestWithAuthorization(t *testing.T) {
+	req, _ := capture(t, NewRequest().Get("/").WithAuthorization("Token", "abc123"))
+	if got := req.Header.Get("Authorization"); got != "Token abc123" {
+		t.Errorf("expected a custom scheme, got %q", got)
+	}
+	req, _ = capture(t, NewRequest().Get("/").WithJWSAuth("jws"))
+	if got := req.Header.Get("Authorization"); got != "Bearer jws" {
+		t.Errorf("expected a bearer token, got %q", got)
+	}
+}
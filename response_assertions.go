@@ -0,0 +1,417 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// AssertStatus checks that the response has the given status code.
+func (c *CompletedRequest) AssertStatus(t TestReporter, code int) {
+	if c.Code() != code {
+		t.Errorf("expected status %d %s, got %d %s", code, http.StatusText(code), c.Code(), http.StatusText(c.Code()))
+	}
+}
+
+// AssertStatusIn checks that the response status is any one of codes, for
+// endpoints which may legitimately respond in more than one way.
+func (c *CompletedRequest) AssertStatusIn(t TestReporter, codes ...int) {
+	for _, code := range codes {
+		if c.Code() == code {
+			return
+		}
+	}
+	t.Errorf("expected status in %v, got %d %s", codes, c.Code(), http.StatusText(c.Code()))
+}
+
+// AssertPreconditionFailed checks that the response status is 412, which is
+// returned when an If-Match precondition doesn't hold.
+func (c *CompletedRequest) AssertPreconditionFailed(t TestReporter) {
+	c.AssertStatus(t, http.StatusPreconditionFailed)
+}
+
+// AssertTooManyRequests checks that the response status is 429, which rate
+// limiters return along with a Retry-After header.
+func (c *CompletedRequest) AssertTooManyRequests(t TestReporter) {
+	c.AssertStatus(t, http.StatusTooManyRequests)
+}
+
+// AssertAccepted checks that the response status is 202, which endpoints
+// return when they've accepted a request for asynchronous processing. Use
+// Location to get the URL to poll.
+func (c *CompletedRequest) AssertAccepted(t TestReporter) {
+	c.AssertStatus(t, http.StatusAccepted)
+}
+
+// AssertPanicked checks that the handler panicked. The request must have been
+// performed with GoRecovering.
+func (c *CompletedRequest) AssertPanicked(t TestReporter) {
+	if !c.Panicked {
+		t.Errorf("expected handler to panic, but it didn't")
+	}
+}
+
+// AssertNoPanic checks that the handler didn't panic, reporting the panic and
+// its stack if it did. The request must have been performed with
+// GoRecovering.
+func (c *CompletedRequest) AssertNoPanic(t TestReporter) {
+	if c.Panicked {
+		t.Errorf("expected handler not to panic, but it panicked: %v\n%s", c.PanicValue, c.PanicStack)
+	}
+}
+
+// AssertGzipEncoded checks that the response declares Content-Encoding: gzip,
+// and that the body really does start with a gzip stream. This catches
+// handlers which set the header but forget to compress the body.
+func (c *CompletedRequest) AssertGzipEncoded(t TestReporter) {
+	encoding := c.Recorder.Header().Get("Content-Encoding")
+	if !strings.EqualFold(strings.TrimSpace(encoding), "gzip") {
+		t.Errorf("expected Content-Encoding gzip, got %q", encoding)
+		return
+	}
+	if _, err := gzip.NewReader(bytes.NewReader(c.Recorder.Body.Bytes())); err != nil {
+		t.Errorf("response body isn't a valid gzip stream: %s", err)
+	}
+}
+
+// AssertNegotiatedEncoding performs the request against handler advertising
+// requested in Accept-Encoding, and checks that the response's
+// Content-Encoding is expected, to test content negotiation end to end. An
+// expected encoding of "" or "identity" means the response mustn't be
+// encoded. The completed request is returned for further assertions, or nil
+// if it couldn't be performed.
+func (r *RequestBuilder) AssertNegotiatedEncoding(t TestReporter, handler http.Handler, requested, expected string) *CompletedRequest {
+	c := r.WithHeader("Accept-Encoding", requested).GoWithHTTPHandler(t, handler)
+	if c == nil {
+		return nil
+	}
+	got := strings.TrimSpace(c.Recorder.Header().Get("Content-Encoding"))
+	if strings.EqualFold(expected, "identity") {
+		expected = ""
+	}
+	if strings.EqualFold(got, "identity") {
+		got = ""
+	}
+	if !strings.EqualFold(got, expected) {
+		t.Errorf("expected Content-Encoding %q when requesting %q, got %q", expected, requested, got)
+	}
+	return c
+}
+
+// AssertDeterministic performs the request against handler n times, and
+// checks that every response body is byte for byte the same as the first.
+// This catches handlers which leak nondeterminism, such as map iteration
+// order, into their responses. Only the first differing response is
+// reported.
+func (r *RequestBuilder) AssertDeterministic(t TestReporter, handler http.Handler, n int) {
+	var first []byte
+	for i := 0; i < n; i++ {
+		c := r.GoWithHTTPHandler(t, handler)
+		if c == nil {
+			return
+		}
+		body := c.Recorder.Body.Bytes()
+		if i == 0 {
+			first = body
+			continue
+		}
+		if !bytes.Equal(body, first) {
+			offset := 0
+			for offset < len(body) && offset < len(first) && body[offset] == first[offset] {
+				offset++
+			}
+			t.Errorf("expected identical responses, but response %d differs from response 1 at byte %d:\n%q\n%q", i+1, offset, first, body)
+			return
+		}
+	}
+}
+
+// AssertFlushed checks that the handler flushed the response, which is
+// expected of streaming handlers.
+func (c *CompletedRequest) AssertFlushed(t TestReporter) {
+	if !c.Recorder.Flushed {
+		t.Errorf("expected response to be flushed, but it wasn't")
+	}
+}
+
+// AssertCookieCount checks how many Set-Cookie headers the response has,
+// listing the names of the cookies on mismatch.
+func (c *CompletedRequest) AssertCookieCount(t TestReporter, want int) {
+	values := c.Recorder.Header().Values("Set-Cookie")
+	if len(values) == want {
+		return
+	}
+	resp := http.Response{Header: c.Recorder.Header()}
+	var names []string
+	for _, cookie := range resp.Cookies() {
+		names = append(names, cookie.Name)
+	}
+	t.Errorf("expected %d cookies to be set, got %d: %q", want, len(values), names)
+}
+
+// AssertBodySHA256 checks the hex-encoded SHA-256 digest of the raw response
+// body, which pins binary responses such as images without embedding them
+// in the test.
+func (c *CompletedRequest) AssertBodySHA256(t TestReporter, want string) {
+	if got := c.BodySHA256(); !strings.EqualFold(got, want) {
+		t.Errorf("expected body sha256 %s, got %s", want, got)
+	}
+}
+
+// AssertDifferentETag checks that this response and other have different
+// ETags, as after updating a resource. It fails if both are missing.
+func (c *CompletedRequest) AssertDifferentETag(t TestReporter, other *CompletedRequest) {
+	got, prev := c.Recorder.Header().Get("ETag"), other.Recorder.Header().Get("ETag")
+	if got == "" && prev == "" {
+		t.Errorf("expected different ETags, but neither response has one")
+	} else if got == prev {
+		t.Errorf("expected different ETags, but both are %s", got)
+	}
+}
+
+// AssertSameETag checks that this response and other have the same ETag, as
+// for an unchanged resource. It fails if either is missing.
+func (c *CompletedRequest) AssertSameETag(t TestReporter, other *CompletedRequest) {
+	got, prev := c.Recorder.Header().Get("ETag"), other.Recorder.Header().Get("ETag")
+	if got == "" || prev == "" {
+		t.Errorf("expected the same ETag, got %q and %q", got, prev)
+	} else if got != prev {
+		t.Errorf("expected the same ETag, got %s and %s", got, prev)
+	}
+}
+
+// AssertHeaders checks that every header in want is present in the response
+// with exactly the given values, in order. Extra response headers are
+// ignored. Each mismatching header is reported separately.
+func (c *CompletedRequest) AssertHeaders(t TestReporter, want http.Header) {
+	c.assertHeaders(t, want, false)
+}
+
+// AssertHeadersExact is like AssertHeaders, but also fails on each response
+// header which isn't in want, for exhaustive contract tests.
+func (c *CompletedRequest) AssertHeadersExact(t TestReporter, want http.Header) {
+	c.assertHeaders(t, want, true)
+}
+
+func (c *CompletedRequest) assertHeaders(t TestReporter, want http.Header, exact bool) {
+	got := c.Recorder.Header()
+
+	expected := make(map[string]bool, len(want))
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		expected[http.CanonicalHeaderKey(k)] = true
+		gotValues := got.Values(k)
+		if len(gotValues) == 0 {
+			t.Errorf("expected header %s: %q, but it's missing", k, want[k])
+		} else if !reflect.DeepEqual(gotValues, want[k]) {
+			t.Errorf("expected header %s: %q, got %q", k, want[k], gotValues)
+		}
+	}
+
+	if exact {
+		extra := make([]string, 0, len(got))
+		for k := range got {
+			if !expected[k] {
+				extra = append(extra, k)
+			}
+		}
+		sort.Strings(extra)
+		for _, k := range extra {
+			t.Errorf("unexpected header %s: %q", k, got[k])
+		}
+	}
+}
+
+// AssertContentLanguage checks the response's Content-Language header.
+func (c *CompletedRequest) AssertContentLanguage(t TestReporter, want string) {
+	if got := c.Recorder.Header().Get("Content-Language"); got != want {
+		t.Errorf("expected Content-Language %q, got %q", want, got)
+	}
+}
+
+// AssertHeaderCount checks that the response has at most max distinct
+// headers, to catch middleware which leaks headers into responses.
+func (c *CompletedRequest) AssertHeaderCount(t TestReporter, max int) {
+	if keys := c.HeaderKeys(); len(keys) > max {
+		t.Errorf("expected at most %d headers, got %d: %q", max, len(keys), keys)
+	}
+}
+
+// AssertCacheControl checks that the response's Cache-Control header has the
+// given directive with the value want. Use an empty want for directives
+// without a value, such as no-store.
+func (c *CompletedRequest) AssertCacheControl(t TestReporter, directive, want string) {
+	got, ok := c.CacheControl()[strings.ToLower(directive)]
+	raw := c.Recorder.Header().Values("Cache-Control")
+	if !ok {
+		t.Errorf("expected Cache-Control directive %s, but it's missing from %q", directive, raw)
+	} else if got != want {
+		t.Errorf("expected Cache-Control directive %s=%q, got %q in %q", directive, want, got, raw)
+	}
+}
+
+// AssertVary checks that the response's Vary header includes each of the
+// given header names, compared case-insensitively. Other names may also be
+// present. A Vary of "*" includes every name.
+func (c *CompletedRequest) AssertVary(t TestReporter, headers ...string) {
+	varies := make(map[string]bool)
+	for _, value := range c.Recorder.Header().Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			varies[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+	if varies["*"] {
+		return
+	}
+	var missing []string
+	for _, h := range headers {
+		if !varies[http.CanonicalHeaderKey(h)] {
+			missing = append(missing, h)
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("expected Vary to include %q, got %q", missing, c.Recorder.Header().Values("Vary"))
+	}
+}
+
+// AssertHeaderSet checks that the response header key has exactly the values
+// in want, in any order, reporting values which are missing or unexpected.
+// Each value is a separate header line, as with Link, so comma-separated
+// values within a line aren't split.
+func (c *CompletedRequest) AssertHeaderSet(t TestReporter, key string, want ...string) {
+	counts := make(map[string]int)
+	for _, v := range want {
+		counts[v]++
+	}
+	var extra []string
+	for _, v := range c.Recorder.Header().Values(key) {
+		if counts[v] == 0 {
+			extra = append(extra, v)
+			continue
+		}
+		counts[v]--
+	}
+	var missing []string
+	for _, v := range want {
+		if counts[v] > 0 {
+			missing = append(missing, v)
+			counts[v]--
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("expected header %s to include %q, got %q", key, missing, c.Recorder.Header().Values(key))
+	}
+	if len(extra) > 0 {
+		t.Errorf("unexpected values for header %s: %q", key, extra)
+	}
+}
+
+// AssertConnectionClose checks that the response's Connection header asks for
+// the connection to be closed.
+func (c *CompletedRequest) AssertConnectionClose(t TestReporter) {
+	values := c.Recorder.Header().Values("Connection")
+	for _, value := range values {
+		for _, option := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(option), "close") {
+				return
+			}
+		}
+	}
+	t.Errorf("expected Connection: close, got %q", values)
+}
+
+// AssertResponseSizeLessThan checks that the response body, as sent, is
+// strictly smaller than maxBytes.
+func (c *CompletedRequest) AssertResponseSizeLessThan(t TestReporter, maxBytes int) {
+	if size := c.Recorder.Body.Len(); size >= maxBytes {
+		t.Errorf("expected response body to be less than %d bytes, got %d", maxBytes, size)
+	}
+}
+
+// AssertDecodedResponseSizeLessThan is like AssertResponseSizeLessThan, but
+// measures the body after undoing any Content-Encoding, such as gzip.
+func (c *CompletedRequest) AssertDecodedResponseSizeLessThan(t TestReporter, maxBytes int) {
+	body, err := c.decodeBody(bytes.NewReader(c.Recorder.Body.Bytes()))
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	size, err := io.Copy(io.Discard, body)
+	if err != nil {
+		t.Errorf("failed to decode response body: %s", err)
+		return
+	}
+	if size >= int64(maxBytes) {
+		t.Errorf("expected decoded response body to be less than %d bytes, got %d", maxBytes, size)
+	}
+}
+
+// AssertValidUTF8 checks that the raw response body is valid UTF-8, reporting
+// the byte offset of the first invalid sequence.
+func (c *CompletedRequest) AssertValidUTF8(t TestReporter) {
+	body := c.Recorder.Body.Bytes()
+	if utf8.Valid(body) {
+		return
+	}
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRune(body[i:])
+		if r == utf8.RuneError && size == 1 {
+			t.Errorf("expected response body to be valid utf-8, got invalid byte 0x%02x at offset %d", body[i], i)
+			return
+		}
+		i += size
+	}
+}
+
+// AssertMatchesTemplate checks that the response body is what the text/template
+// tmpl renders for data, to test template-driven handlers without hardcoding
+// their output. Runs of whitespace are collapsed, and leading and trailing
+// whitespace is ignored, so indentation and line breaks don't matter.
+func (c *CompletedRequest) AssertMatchesTemplate(t TestReporter, tmpl string, data interface{}) {
+	parsed, err := template.New("expected").Parse(tmpl)
+	if err != nil {
+		t.Errorf("failed to parse template: %s", err)
+		return
+	}
+	var want strings.Builder
+	if err := parsed.Execute(&want, data); err != nil {
+		t.Errorf("failed to execute template: %s", err)
+		return
+	}
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	if got := normalize(c.Recorder.Body.String()); got != normalize(want.String()) {
+		t.Errorf("expected body to match template output %q, got %q", normalize(want.String()), got)
+	}
+}
+
+// AssertBodyEndsWith checks that the raw response body ends with suffix.
+func (c *CompletedRequest) AssertBodyEndsWith(t TestReporter, suffix string) {
+	body := c.Recorder.Body.String()
+	if strings.HasSuffix(body, suffix) {
+		return
+	}
+	tail := body
+	if len(tail) > len(suffix)+20 {
+		tail = "..." + tail[len(tail)-len(suffix)-20:]
+	}
+	t.Errorf("expected body to end with %q, got %q", suffix, tail)
+}
+
+// AssertBodyHasTrailingNewline checks that the response body ends with a
+// newline, as json.Encoder writes but json.Marshal doesn't, which some
+// clients and contract tests depend on.
+func (c *CompletedRequest) AssertBodyHasTrailingNewline(t TestReporter) {
+	c.AssertBodyEndsWith(t, "\n")
+}
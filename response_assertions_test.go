@@ -0,0 +1,276 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAssertStatusIn(t *testing.T) {
+	c := get(t, withHeaders(nil, http.StatusTooManyRequests, ""))
+	var r fakeReporter
+	c.AssertStatusIn(&r, http.StatusOK, http.StatusTooManyRequests)
+	r.expectNoErrors(t)
+
+	c.AssertStatusIn(&r, http.StatusOK, http.StatusCreated)
+	r.expectError(t, "expected status in [200 201], got 429 Too Many Requests")
+}
+
+func TestAssertTooManyRequests(t *testing.T) {
+	var r fakeReporter
+	get(t, withHeaders(nil, http.StatusTooManyRequests, "")).AssertTooManyRequests(&r)
+	r.expectNoErrors(t)
+
+	get(t, withHeaders(nil, http.StatusOK, "")).AssertTooManyRequests(&r)
+	r.expectError(t, "expected status 429 Too Many Requests, got 200 OK")
+}
+
+func TestAssertPanicked(t *testing.T) {
+	var r fakeReporter
+	c := NewRequest().Get("/").GoRecovering(&r, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	}))
+	c.AssertPanicked(&r)
+	r.expectNoErrors(t)
+	c.AssertNoPanic(&r)
+	r.expectError(t, "expected handler not to panic, but it panicked: boom\n")
+
+	r = fakeReporter{}
+	c = NewRequest().Get("/").GoRecovering(&r, respond("", ""))
+	c.AssertPanicked(&r)
+	r.expectError(t, "expected handler to panic, but it didn't")
+}
+
+func TestAssertHeaders(t *testing.T) {
+	c := get(t, withHeaders(http.Header{
+		"Content-Type": {"application/json"},
+		"Link":         {"<a>", "<b>"},
+		"X-Extra":      {"1"},
+	}, http.StatusOK, ""))
+	want := http.Header{"content-type": {"application/json"}, "Link": {"<a>", "<b>"}}
+
+	var r fakeReporter
+	c.AssertHeaders(&r, want)
+	r.expectNoErrors(t)
+
+	// Strict is about decoding bodies, and doesn't affect header checks.
+	c.Strict = true
+	c.AssertHeaders(&r, want)
+	r.expectNoErrors(t)
+
+	c.AssertHeadersExact(&r, want)
+	r.expectError(t, `unexpected header X-Extra: ["1"]`)
+
+	r = fakeReporter{}
+	c.AssertHeaders(&r, http.Header{"Link": {"<b>", "<a>"}, "X-Missing": {"x"}})
+	if len(r.errors) != 2 ||
+		r.errors[0] != `expected header Link: ["<b>" "<a>"], got ["<a>" "<b>"]` ||
+		r.errors[1] != `expected header X-Missing: ["x"], but it's missing` {
+		t.Errorf("unexpected errors %q", r.errors)
+	}
+}
+
+func TestAssertHeaderSet(t *testing.T) {
+	c := get(t, withHeaders(http.Header{"Link": {"<a>", "<b>", "<b>"}}, http.StatusOK, ""))
+	var r fakeReporter
+	c.AssertHeaderSet(&r, "Link", "<b>", "<a>", "<b>")
+	r.expectNoErrors(t)
+
+	c.AssertHeaderSet(&r, "Link", "<a>", "<b>", "<c>")
+	if len(r.errors) != 2 ||
+		!strings.HasPrefix(r.errors[0], `expected header Link to include ["<c>"]`) ||
+		r.errors[1] != `unexpected values for header Link: ["<b>"]` {
+		t.Errorf("unexpected errors %q", r.errors)
+	}
+}
+
+func TestAssertVary(t *testing.T) {
+	c := get(t, withHeaders(http.Header{"Vary": {"accept-encoding, Origin", "Accept"}}, http.StatusOK, ""))
+	var r fakeReporter
+	c.AssertVary(&r, "Accept-Encoding", "origin", "Accept")
+	r.expectNoErrors(t)
+	c.AssertVary(&r, "Cookie", "Accept")
+	r.expectError(t, `expected Vary to include ["Cookie"]`)
+
+	r = fakeReporter{}
+	get(t, withHeaders(http.Header{"Vary": {"*"}}, http.StatusOK, "")).AssertVary(&r, "Anything")
+	r.expectNoErrors(t)
+}
+
+func TestAssertCacheControl(t *testing.T) {
+	c := get(t, withHeaders(http.Header{"Cache-Control": {"no-store, Max-Age=60"}}, http.StatusOK, ""))
+	var r fakeReporter
+	c.AssertCacheControl(&r, "no-store", "")
+	c.AssertCacheControl(&r, "MAX-AGE", "60")
+	r.expectNoErrors(t)
+
+	c.AssertCacheControl(&r, "max-age", "30")
+	r.expectError(t, `expected Cache-Control directive max-age="30", got "60"`)
+
+	r = fakeReporter{}
+	c.AssertCacheControl(&r, "private", "")
+	r.expectError(t, "expected Cache-Control directive private, but it's missing")
+}
+
+func TestAssertConnectionClose(t *testing.T) {
+	var r fakeReporter
+	get(t, withHeaders(http.Header{"Connection": {"keep-alive, Close"}}, http.StatusOK, "")).AssertConnectionClose(&r)
+	r.expectNoErrors(t)
+	get(t, withHeaders(http.Header{"Connection": {"keep-alive"}}, http.StatusOK, "")).AssertConnectionClose(&r)
+	r.expectError(t, `expected Connection: close, got ["keep-alive"]`)
+}
+
+func TestAssertCookieCount(t *testing.T) {
+	c := get(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+		http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+	}))
+	var r fakeReporter
+	c.AssertCookieCount(&r, 2)
+	r.expectNoErrors(t)
+	c.AssertCookieCount(&r, 1)
+	r.expectError(t, `expected 1 cookies to be set, got 2: ["a" "b"]`)
+}
+
+func TestAssertETags(t *testing.T) {
+	etag := func(v string) *CompletedRequest {
+		h := http.Header{}
+		if v != "" {
+			h.Set("ETag", v)
+		}
+		return get(t, withHeaders(h, http.StatusOK, ""))
+	}
+	var r fakeReporter
+	etag(`"1"`).AssertSameETag(&r, etag(`"1"`))
+	etag(`"1"`).AssertDifferentETag(&r, etag(`"2"`))
+	r.expectNoErrors(t)
+
+	etag("").AssertDifferentETag(&r, etag(""))
+	r.expectError(t, "neither response has one")
+
+	r = fakeReporter{}
+	etag(`"1"`).AssertSameETag(&r, etag(""))
+	r.expectError(t, `expected the same ETag, got "\"1\"" and ""`)
+}
+
+func TestAssertGzipEncoded(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte("hello"))
+	_ = w.Close()
+
+	var r fakeReporter
+	get(t, withHeaders(http.Header{"Content-Encoding": {"gzip"}}, http.StatusOK, buf.String())).AssertGzipEncoded(&r)
+	r.expectNoErrors(t)
+
+	get(t, withHeaders(http.Header{"Content-Encoding": {"gzip"}}, http.StatusOK, "hello")).AssertGzipEncoded(&r)
+	r.expectError(t, "response body isn't a valid gzip stream")
+
+	r = fakeReporter{}
+	get(t, withHeaders(nil, http.StatusOK, buf.String())).AssertGzipEncoded(&r)
+	r.expectError(t, `expected Content-Encoding gzip, got ""`)
+}
+
+func TestAssertNegotiatedEncoding(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+	})
+	var r fakeReporter
+	NewRequest().Get("/").AssertNegotiatedEncoding(&r, handler, "gzip, br", "GZIP")
+	NewRequest().Get("/").AssertNegotiatedEncoding(&r, handler, "br", "identity")
+	r.expectNoErrors(t)
+
+	NewRequest().Get("/").AssertNegotiatedEncoding(&r, handler, "gzip", "")
+	r.expectError(t, `expected Content-Encoding "" when requesting "gzip", got "gzip"`)
+}
+
+func TestAssertDeterministic(t *testing.T) {
+	var r fakeReporter
+	NewRequest().Get("/").AssertDeterministic(&r, respond("", "same"), 3)
+	r.expectNoErrors(t)
+
+	n := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n++
+		_, _ = w.Write([]byte("count=" + strconv.Itoa(n/3)))
+	})
+	NewRequest().Get("/").AssertDeterministic(&r, handler, 5)
+	r.expectError(t, "response 3 differs from response 1 at byte 6")
+}
+
+func TestAssertResponseSizes(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(bytes.Repeat([]byte("a"), 1000))
+	_ = w.Close()
+	c := get(t, withHeaders(http.Header{"Content-Encoding": {"gzip"}}, http.StatusOK, buf.String()))
+
+	var r fakeReporter
+	c.AssertResponseSizeLessThan(&r, 100)
+	c.AssertDecodedResponseSizeLessThan(&r, 1001)
+	r.expectNoErrors(t)
+
+	c.AssertDecodedResponseSizeLessThan(&r, 1000)
+	r.expectError(t, "expected decoded response body to be less than 1000 bytes, got 1000")
+}
+
+func TestAssertValidUTF8(t *testing.T) {
+	var r fakeReporter
+	get(t, respond("text/plain", "héllo")).AssertValidUTF8(&r)
+	r.expectNoErrors(t)
+	get(t, respond("text/plain", "hé\xffllo")).AssertValidUTF8(&r)
+	r.expectError(t, "got invalid byte 0xff at offset 3")
+}
+
+func TestAssertMatchesTemplate(t *testing.T) {
+	c := get(t, respond("text/html", "<ul>\n  <li>a</li>\n  <li>b</li>\n</ul>\n"))
+	var r fakeReporter
+	c.AssertMatchesTemplate(&r, `<ul> {{range .}}<li>{{.}}</li> {{end}}</ul>`, []string{"a", "b"})
+	r.expectNoErrors(t)
+
+	c.AssertMatchesTemplate(&r, `<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>`, []string{"a"})
+	r.expectError(t, "expected body to match template output")
+
+	r = fakeReporter{}
+	c.AssertMatchesTemplate(&r, `{{`, nil)
+	r.expectError(t, "failed to parse template")
+}
+
+func TestAssertBodyEndsWith(t *testing.T) {
+	var r fakeReporter
+	c := get(t, respond("application/json", `{"a":1}`+"\n"))
+	c.AssertBodyEndsWith(&r, "1}\n")
+	c.AssertBodyHasTrailingNewline(&r)
+	r.expectNoErrors(t)
+
+	get(t, respond("", strings.Repeat("x", 40)+"end")).AssertBodyEndsWith(&r, "\n")
+	r.expectError(t, `expected body to end with "\n", got "...xxxxxxxxxxxxxxxxxxend"`)
+}
+
+func TestAssertHeaderCount(t *testing.T) {
+	c := get(t, withHeaders(http.Header{"Content-Language": {"en"}, "X-A": {"1"}}, http.StatusOK, ""))
+	var r fakeReporter
+	c.AssertHeaderCount(&r, 2)
+	r.expectNoErrors(t)
+	c.AssertHeaderCount(&r, 1)
+	r.expectError(t, `expected at most 1 headers, got 2: ["Content-Language" "X-A"]`)
+}
+
+func TestAssertFlushed(t *testing.T) {
+	streaming := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	})
+	var r fakeReporter
+	get(t, streaming).AssertFlushed(&r)
+	r.expectNoErrors(t)
+
+	get(t, respond("text/event-stream", "data: 1\n\n")).AssertFlushed(&r)
+	r.expectError(t, "expected response to be flushed, but it wasn't")
+}
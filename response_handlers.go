@@ -1,6 +1,10 @@
 package testutil
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
 	"io"
 	"sync"
@@ -8,13 +12,19 @@ import (
 
 func init() {
 	knownHandlers = make(map[string]ResponseHandler)
+	knownDecoders = make(map[string]ContentDecoder)
 
 	RegisterResponseHandler("application/json", jsonHandler)
+	RegisterContentDecoder("gzip", gzipDecoder)
+	RegisterContentDecoder("deflate", deflateDecoder)
 }
 
 var (
 	knownHandlersMu sync.Mutex
 	knownHandlers   map[string]ResponseHandler
+
+	knownDecodersMu sync.Mutex
+	knownDecoders   map[string]ContentDecoder
 )
 
 type ResponseHandler func(contentType string, raw io.Reader, obj interface{}, strict bool) error
@@ -39,6 +49,56 @@ func jsonHandler(_ string, r io.Reader, obj interface{}, strict bool) error {
 	d := json.NewDecoder(r)
 	if strict {
 		d.DisallowUnknownFields()
+		return d.Decode(obj)
+	}
+	// Only the first JSON value is decoded, whatever follows it, as when
+	// decoding straight into obj. It's then passed to JsonUnmarshal.
+	var raw json.RawMessage
+	if err := d.Decode(&raw); err != nil {
+		return err
+	}
+	return JsonUnmarshal(raw, obj)
+}
+
+// ContentDecoder undoes a Content-Encoding, returning a reader over the
+// decoded body.
+type ContentDecoder func(r io.Reader) (io.Reader, error)
+
+// RegisterContentDecoder registers a decoder for the given Content-Encoding,
+// which UnmarshalBodyToObject then uses to transparently decode responses.
+func RegisterContentDecoder(encoding string, decoder ContentDecoder) {
+	knownDecodersMu.Lock()
+	defer knownDecodersMu.Unlock()
+
+	knownDecoders[encoding] = decoder
+}
+
+func getDecoder(encoding string) ContentDecoder {
+	knownDecodersMu.Lock()
+	defer knownDecodersMu.Unlock()
+
+	return knownDecoders[encoding]
+}
+
+func gzipDecoder(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// deflateDecoder handles the deflate encoding, which is meant to be a zlib
+// stream, but which some servers send as raw DEFLATE data instead. We check
+// for a zlib header first, and fall back to raw DEFLATE without one.
+func deflateDecoder(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && isZlibHeader(header) {
+		return zlib.NewReader(br)
 	}
-	return d.Decode(obj)
+	return flate.NewReader(br), nil
+}
+
+// isZlibHeader reports whether b starts with a valid zlib header, as
+// described in RFC 1950: the DEFLATE compression method, with check bits
+// making the first two bytes a multiple of 31.
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
 }
@@ -0,0 +1,204 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zlibWriter(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+
+func gzipWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+func flateWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func TestIsZlibHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   bool
+	}{
+		{"default compression", []byte{0x78, 0x9c}, true},
+		{"best compression", []byte{0x78, 0xda}, true},
+		{"no compression", []byte{0x78, 0x01}, true},
+		{"bad check bits", []byte{0x78, 0x9d}, false},
+		{"not deflate", []byte{0x79, 0x9c}, false},
+		{"raw deflate", []byte{0x4a, 0x4c}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isZlibHeader(tt.header); got != tt.want {
+				t.Errorf("expected %v for % x, got %v", tt.want, tt.header, got)
+			}
+		})
+	}
+}
+
+func TestDeflateDecoder(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"zlib", compress(t, zlibWriter, "hello, deflate")},
+		{"raw deflate", compress(t, flateWriter, "hello, deflate")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := deflateDecoder(bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "hello, deflate" {
+				t.Errorf("expected %q, got %q", "hello, deflate", got)
+			}
+		})
+	}
+}
+
+// encoded returns a handler which responds with a JSON body, encoded as
+// described by the given Content-Encoding.
+func encoded(encoding string, body []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		_, _ = w.Write(body)
+	})
+}
+
+func TestUnmarshalBodyToObjectDecodesContent(t *testing.T) {
+	const body = `{"name":"x"}`
+	gzipped := compress(t, gzipWriter, body)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"none", "", []byte(body)},
+		{"identity", "identity", []byte(body)},
+		{"gzip", "gzip", gzipped},
+		{"case insensitive", "GZip", gzipped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct{ Name string }
+			if err := get(t, encoded(tt.encoding, tt.body)).UnmarshalBodyToObject(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != "x" {
+				t.Errorf("expected name %q, got %q", "x", got.Name)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBodyToObjectDecodesDeflate(t *testing.T) {
+	const body = `{"name":"x"}`
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"zlib", "deflate", compress(t, zlibWriter, body)},
+		{"raw deflate", "deflate", compress(t, flateWriter, body)},
+		{"stacked", "deflate, gzip", compress(t, gzipWriter, string(compress(t, zlibWriter, body)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct{ Name string }
+			if err := get(t, encoded(tt.encoding, tt.body)).UnmarshalBodyToObject(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != "x" {
+				t.Errorf("expected name %q, got %q", "x", got.Name)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBodyToObjectUnknownEncoding(t *testing.T) {
+	var got struct{}
+	err := get(t, encoded("zstd", []byte("{}"))).UnmarshalBodyToObject(&got)
+	if err == nil || err.Error() != "unhandled content encoding: zstd" {
+		t.Errorf("expected an unhandled encoding error, got %v", err)
+	}
+}
+
+func TestUnmarshalBodyToObjectCorruptEncoding(t *testing.T) {
+	var got struct{}
+	err := get(t, encoded("gzip", []byte("{}"))).UnmarshalBodyToObject(&got)
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to decode gzip content: ") {
+		t.Errorf("expected a gzip decoding error, got %v", err)
+	}
+}
+
+func TestJsonHandler(t *testing.T) {
+	type named struct{ Name string }
+	tests := []struct {
+		name    string
+		body    string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", body: `{"name":"x"}`, want: "x"},
+		{name: "trailing data", body: `{"name":"x"} trailing`, want: "x"},
+		{name: "unknown field", body: `{"name":"x","age":1}`, want: "x"},
+		{name: "strict unknown field", body: `{"name":"x","age":1}`, strict: true, wantErr: true},
+		{name: "strict known fields", body: `{"name":"x"}`, strict: true, want: "x"},
+		{name: "empty", body: ``, wantErr: true},
+		{name: "invalid", body: `{"name":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got named
+			err := jsonHandler("application/json", strings.NewReader(tt.body), &got, tt.strict)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.want {
+				t.Errorf("expected name %q, got %q", tt.want, got.Name)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBodyToObjectUnhandledContentType(t *testing.T) {
+	var got struct{}
+	err := get(t, respond("text/csv", "a,b")).UnmarshalBodyToObject(&got)
+	if err == nil || err.Error() != "unhandled content: text/csv" {
+		t.Errorf("expected an unhandled content error, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package testutil
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerTimingMetric is a single metric from a Server-Timing header.
+type ServerTimingMetric struct {
+	Name string
+	// Dur is the metric's duration, or zero if it doesn't have one.
+	Dur  time.Duration
+	Desc string
+}
+
+// ServerTiming parses the response's Server-Timing headers into their
+// metrics, in order. For example, `db;dur=53.2, cache;desc="Cache Read"`
+// gives a db metric lasting 53.2ms, and a cache metric with a description.
+func (c *CompletedRequest) ServerTiming() []ServerTimingMetric {
+	var metrics []ServerTimingMetric
+	raw := strings.Join(c.Recorder.Header().Values("Server-Timing"), ",")
+	for _, entry := range splitQuoted(raw, ',') {
+		params := splitQuoted(entry, ';')
+		m := ServerTimingMetric{Name: strings.TrimSpace(params[0])}
+		if m.Name == "" {
+			continue
+		}
+		for _, p := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			value = unquoteHeaderValue(strings.TrimSpace(value))
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "dur":
+				if ms, err := strconv.ParseFloat(value, 64); err == nil {
+					m.Dur = time.Duration(ms * float64(time.Millisecond))
+				}
+			case "desc":
+				m.Desc = value
+			}
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// AssertServerTiming checks that the response's Server-Timing headers include
+// a metric with the given name.
+func (c *CompletedRequest) AssertServerTiming(t TestReporter, name string) {
+	metrics := c.ServerTiming()
+	names := make([]string, len(metrics))
+	for i, m := range metrics {
+		if m.Name == name {
+			return
+		}
+		names[i] = m.Name
+	}
+	t.Errorf("expected Server-Timing metric %s, got %q", name, names)
+}
@@ -0,0 +1,31 @@
+package testutil
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerTiming(t *testing.T) {
+	c := get(t, withHeaders(http.Header{"Server-Timing": {
+		`db;dur=53.2, cache;desc="Cache Read, Hot";dur=1`,
+		`total;DUR=bad, , miss`,
+	}}, http.StatusOK, ""))
+
+	want := []ServerTimingMetric{
+		{Name: "db", Dur: 53200 * time.Microsecond},
+		{Name: "cache", Dur: time.Millisecond, Desc: "Cache Read, Hot"},
+		{Name: "total"},
+		{Name: "miss"},
+	}
+	if got := c.ServerTiming(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	var r fakeReporter
+	c.AssertServerTiming(&r, "cache")
+	r.expectNoErrors(t)
+	c.AssertServerTiming(&r, "app")
+	r.expectError(t, `expected Server-Timing metric app, got ["db" "cache" "total" "miss"]`)
+}
@@ -0,0 +1,92 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Session holds credentials captured from a login response, and produces
+// request builders which send them, to cover the common pattern of
+// authenticating and then calling the API.
+type Session struct {
+	// Cookies are sent with every request built by the session.
+	Cookies []*http.Cookie
+	// Token, if set, is sent as a bearer token with every request built by
+	// the session.
+	Token string
+}
+
+// SessionExtractor captures credentials from a login response into the
+// session.
+type SessionExtractor func(c *CompletedRequest, s *Session) error
+
+// Login performs loginReq against handler, and returns a Session holding the
+// cookies set by the response. It returns nil, failing the test, if the login
+// request fails.
+func Login(t TestReporter, handler http.Handler, loginReq *RequestBuilder) *Session {
+	return LoginWith(t, handler, loginReq, SessionCookies)
+}
+
+// LoginWith is like Login, but captures credentials from the login response
+// using extract.
+func LoginWith(t TestReporter, handler http.Handler, loginReq *RequestBuilder, extract SessionExtractor) *Session {
+	c := loginReq.GoWithHTTPHandler(t, handler)
+	if c == nil {
+		return nil
+	}
+	if c.Code() < 200 || c.Code() > 299 {
+		t.Errorf("login failed with status %d %s", c.Code(), http.StatusText(c.Code()))
+		return nil
+	}
+	s := &Session{}
+	if err := extract(c, s); err != nil {
+		t.Errorf("failed to extract session from login response: %s", err)
+		return nil
+	}
+	return s
+}
+
+// New returns a request builder which carries the session's credentials.
+func (s *Session) New() *RequestBuilder {
+	r := NewRequest()
+	for _, c := range s.Cookies {
+		r.WithCookie(c)
+	}
+	if s.Token != "" {
+		r.WithJWSAuth(s.Token)
+	}
+	return r
+}
+
+// SessionCookies is a SessionExtractor which captures every cookie set by the
+// login response.
+func SessionCookies(c *CompletedRequest, s *Session) error {
+	resp := http.Response{Header: c.Recorder.Header()}
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return errors.New("login response didn't set any cookies")
+	}
+	for _, cookie := range cookies {
+		s.Cookies = append(s.Cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return nil
+}
+
+// SessionTokenFromJson returns a SessionExtractor which captures a bearer
+// token from the string at the given dotted path in the login response's JSON
+// body.
+func SessionTokenFromJson(field string) SessionExtractor {
+	return func(c *CompletedRequest, s *Session) error {
+		v, err := c.lookupJsonField(field)
+		if err != nil {
+			return err
+		}
+		token, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected field %q to be a string, got %s", field, jsonTypeName(v))
+		}
+		s.Token = token
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLogin(t *testing.T) {
+	login := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", HttpOnly: true, Path: "/"})
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"auth":{"token":"t0k"}}`))
+	})
+
+	s := Login(t, login, NewRequest().Post("/login"))
+	if s == nil || len(s.Cookies) != 1 || s.Cookies[0].Name != "session" || s.Cookies[0].Value != "abc" {
+		t.Fatalf("expected the session cookie, got %+v", s)
+	}
+	req, _ := capture(t, s.New().Get("/me"))
+	if c, err := req.Cookie("session"); err != nil || c.Value != "abc" {
+		t.Errorf("expected the session cookie to be sent, got %v, %v", c, err)
+	}
+
+	s = LoginWith(t, login, NewRequest().Post("/login"), SessionTokenFromJson("auth.token"))
+	if s == nil || s.Token != "t0k" {
+		t.Fatalf("expected the token, got %+v", s)
+	}
+	req, _ = capture(t, s.New().Get("/me"))
+	if got := req.Header.Get("Authorization"); got != "Bearer t0k" {
+		t.Errorf("expected the token to be sent, got %q", got)
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	var r fakeReporter
+	if s := Login(&r, withHeaders(nil, http.StatusUnauthorized, ""), NewRequest().Post("/login")); s != nil {
+		t.Errorf("expected no session, got %+v", s)
+	}
+	r.expectError(t, "login failed with status 401 Unauthorized")
+
+	r = fakeReporter{}
+	Login(&r, respond("", ""), NewRequest().Post("/login"))
+	r.expectError(t, "failed to extract session from login response: login response didn't set any cookies")
+
+	r = fakeReporter{}
+	LoginWith(&r, respond("application/json", `{"token":1}`), NewRequest().Post("/login"), SessionTokenFromJson("token"))
+	r.expectError(t, `expected field "token" to be a string, got number`)
+}
@@ -0,0 +1,125 @@
+package testutil
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SSEEvent is a single event read from a text/event-stream response.
+type SSEEvent struct {
+	// Event is the event type. Per the SSE spec, it defaults to "message"
+	// when the stream doesn't specify one.
+	Event string
+	// Data is the event payload. Multiple data lines are joined with "\n".
+	Data string
+	// ID is the last event ID seen on the stream, which carries over to
+	// subsequent events until it's changed.
+	ID string
+	// Retry is the reconnection time sent with this event, or zero if none
+	// was sent.
+	Retry time.Duration
+}
+
+// EachSSEEvent parses the response body as a Server-Sent Events stream and
+// calls fn for every event in it, in order. Comment lines are skipped. If fn
+// returns an error, parsing stops and the error is returned.
+func (c *CompletedRequest) EachSSEEvent(fn func(event SSEEvent) error) error {
+	return readSSE(bytes.NewReader(c.Recorder.Body.Bytes()), fn)
+}
+
+// readSSE implements the event stream interpretation described in the
+// HTML Living Standard, section 9.2.6.
+func readSSE(r io.Reader, fn func(event SSEEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	scanner.Split(scanSSELines)
+
+	var (
+		lastID string
+		event  string
+		data   strings.Builder
+		retry  time.Duration
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line dispatches the event. Events without any data
+			// are discarded, per the spec.
+			if data.Len() > 0 {
+				ev := SSEEvent{
+					Event: event,
+					Data:  strings.TrimSuffix(data.String(), "\n"),
+					ID:    lastID,
+					Retry: retry,
+				}
+				if ev.Event == "" {
+					ev.Event = "message"
+				}
+				if err := fn(ev); err != nil {
+					return err
+				}
+			}
+			event = ""
+			data.Reset()
+			retry = 0
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment line
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	// Any event which wasn't terminated by a blank line is incomplete, and
+	// is discarded.
+	return scanner.Err()
+}
+
+// scanSSELines is a bufio.SplitFunc which accepts any of CRLF, LF or CR as
+// a line terminator.
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// We have a CR, and need to know whether an LF follows it.
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,113 @@
+package testutil
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAllSSE(t *testing.T, stream string) []SSEEvent {
+	t.Helper()
+	var events []SSEEvent
+	err := readSSE(strings.NewReader(stream), func(e SSEEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestReadSSEMultipleEvents(t *testing.T) {
+	stream := ": a comment\n" +
+		"data: first\n" +
+		"\n" +
+		"event: update\n" +
+		"id: 42\n" +
+		"retry: 1500\n" +
+		"data: line one\n" +
+		"data:line two\n" +
+		"\n" +
+		"data: inherits id\n" +
+		"\n"
+
+	want := []SSEEvent{
+		{Event: "message", Data: "first"},
+		{Event: "update", Data: "line one\nline two", ID: "42", Retry: 1500 * time.Millisecond},
+		{Event: "message", Data: "inherits id", ID: "42"},
+	}
+	if got := readAllSSE(t, stream); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestReadSSEDiscardsEventsWithoutData(t *testing.T) {
+	stream := "event: ping\n\n" +
+		"data: kept\n\n" +
+		"data: unterminated\n"
+
+	got := readAllSSE(t, stream)
+	if len(got) != 1 || got[0].Data != "kept" {
+		t.Errorf("expected only the kept event, got %+v", got)
+	}
+}
+
+func TestReadSSEIgnoresInvalidFields(t *testing.T) {
+	stream := "id: 1\n\n" +
+		"id: bad\x00id\n" +
+		"retry: soon\n" +
+		"unknown: field\n" +
+		"data: x\n\n"
+
+	got := readAllSSE(t, stream)
+	want := []SSEEvent{{Event: "message", Data: "x", ID: "1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestReadSSELineEndings(t *testing.T) {
+	for name, stream := range map[string]string{
+		"LF":   "data: a\ndata: b\n\n",
+		"CRLF": "data: a\r\ndata: b\r\n\r\n",
+		"CR":   "data: a\rdata: b\r\r",
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := readAllSSE(t, stream)
+			if len(got) != 1 || got[0].Data != "a\nb" {
+				t.Errorf("expected one event with data \"a\\nb\", got %+v", got)
+			}
+		})
+	}
+}
+
+func TestScanSSELinesWaitsForLFAfterCR(t *testing.T) {
+	// A CR at the end of the buffer might be the start of a CRLF, so more
+	// data is needed before the line can be returned.
+	advance, token, err := scanSSELines([]byte("data\r"), false)
+	if advance != 0 || token != nil || err != nil {
+		t.Errorf("expected to request more data, got %d, %q, %v", advance, token, err)
+	}
+
+	advance, token, _ = scanSSELines([]byte("data\r"), true)
+	if advance != 5 || string(token) != "data" {
+		t.Errorf("expected the line at EOF, got %d, %q", advance, token)
+	}
+}
+
+func TestEachSSEEventStopsOnError(t *testing.T) {
+	c := get(t, respond("text/event-stream", "data: 1\n\ndata: 2\n\n"))
+
+	stop := errors.New("stop")
+	calls := 0
+	err := c.EachSSEEvent(func(e SSEEvent) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expected to stop after the first event, got %d calls and %v", calls, err)
+	}
+}
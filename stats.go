@@ -0,0 +1,52 @@
+package testutil
+
+import (
+	"net/http"
+	"time"
+)
+
+// Stats summarizes a request performed repeatedly by Times.
+type Stats struct {
+	Count int
+	Min   time.Duration
+	Max   time.Duration
+	Avg   time.Duration
+	// Statuses counts how many responses had each status code.
+	Statuses map[int]int
+}
+
+// Times performs the request against handler n times in a row, and returns
+// statistics on how long each took and which statuses were returned. This is
+// meant for quick sanity checks in tests, such as making sure an endpoint
+// doesn't degrade when called repeatedly; it is not a load testing tool.
+// Each iteration sends its own copy of the body.
+func (r *RequestBuilder) Times(t TestReporter, handler http.Handler, n int) Stats {
+	stats := Stats{
+		Statuses: make(map[int]int),
+	}
+	var total time.Duration
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		c := r.GoWithHTTPHandler(t, handler)
+		elapsed := time.Since(start)
+		if c == nil {
+			// The request couldn't be constructed, which won't change on
+			// later iterations.
+			break
+		}
+
+		if stats.Count == 0 || elapsed < stats.Min {
+			stats.Min = elapsed
+		}
+		if elapsed > stats.Max {
+			stats.Max = elapsed
+		}
+		total += elapsed
+		stats.Count++
+		stats.Statuses[c.Code()]++
+	}
+	if stats.Count > 0 {
+		stats.Avg = total / time.Duration(stats.Count)
+	}
+	return stats
+}
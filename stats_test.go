@@ -0,0 +1,35 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTimes(t *testing.T) {
+	n := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n%2 == 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	stats := NewRequest().Get("/").Times(t, handler, 5)
+	if stats.Count != 5 || n != 5 {
+		t.Errorf("expected 5 requests, got %d", stats.Count)
+	}
+	if stats.Statuses[http.StatusOK] != 3 || stats.Statuses[http.StatusTooManyRequests] != 2 {
+		t.Errorf("unexpected statuses %v", stats.Statuses)
+	}
+	if stats.Min > stats.Avg || stats.Avg > stats.Max {
+		t.Errorf("expected min <= avg <= max, got %v, %v, %v", stats.Min, stats.Avg, stats.Max)
+	}
+}
+
+func TestTimesStopsOnBuildError(t *testing.T) {
+	var rep fakeReporter
+	stats := NewRequest().Get("relative").Times(&rep, respond("", ""), 3)
+	if stats.Count != 0 || stats.Avg != 0 {
+		t.Errorf("expected no requests, got %+v", stats)
+	}
+	rep.expectError(t, "invalid request")
+}
@@ -0,0 +1,43 @@
+package testutil
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+)
+
+// websocketGUID is the fixed GUID from RFC 6455 which is appended to the key
+// when computing Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WithWebSocketUpgrade sets the headers of a WebSocket opening handshake with
+// the given Sec-WebSocket-Key, for testing the HTTP side of an upgrade. The
+// recorder can't be hijacked, so only the handshake response can be tested.
+func (r *RequestBuilder) WithWebSocketUpgrade(key string) *RequestBuilder {
+	return r.WithHeader("Upgrade", "websocket").
+		WithHeader("Connection", "Upgrade").
+		WithHeader("Sec-WebSocket-Version", "13").
+		WithHeader("Sec-WebSocket-Key", key)
+}
+
+// AssertSwitchingProtocols checks that the response status is 101, as sent
+// when a handler accepts an upgrade.
+func (c *CompletedRequest) AssertSwitchingProtocols(t TestReporter) {
+	c.AssertStatus(t, http.StatusSwitchingProtocols)
+}
+
+// AssertWebSocketAccept checks that the response's Sec-WebSocket-Accept
+// header is the one RFC 6455 requires in response to the given key.
+func (c *CompletedRequest) AssertWebSocketAccept(t TestReporter, key string) {
+	want := WebSocketAccept(key)
+	if got := c.Recorder.Header().Get("Sec-WebSocket-Accept"); got != want {
+		t.Errorf("expected Sec-WebSocket-Accept %q for key %q, got %q", want, key, got)
+	}
+}
+
+// WebSocketAccept computes the Sec-WebSocket-Accept value for a
+// Sec-WebSocket-Key.
+func WebSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWebSocketHandshake(t *testing.T) {
+	// The example handshake from RFC 6455, section 1.3.
+	const key, accept = "dGhlIHNhbXBsZSBub25jZQ==", "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if got := WebSocketAccept(key); got != accept {
+		t.Errorf("expected %q, got %q", accept, got)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Sec-WebSocket-Accept", WebSocketAccept(r.Header.Get("Sec-WebSocket-Key")))
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	})
+	c := NewRequest().Get("/ws").WithWebSocketUpgrade(key).GoWithHTTPHandler(t, handler)
+	var r fakeReporter
+	c.AssertSwitchingProtocols(&r)
+	c.AssertWebSocketAccept(&r, key)
+	r.expectNoErrors(t)
+
+	c.AssertWebSocketAccept(&r, "other")
+	r.expectError(t, `for key "other", got "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="`)
+}